@@ -0,0 +1,135 @@
+package editor
+
+import (
+    "errors"
+    "io"
+    "strings"
+)
+
+const (
+    aiffFormMagic string = "FORM"
+    aiffFormType string = "AIFF"
+    aifcFormType string = "AIFC"
+)
+
+type AiffTagEditor struct {
+    id3 Mp3TagEditor
+}
+
+func (editor *AiffTagEditor) ReadTag(path string) (Tag, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Tag{}, err
+    }
+    defer file.Close()
+
+    chunks, _, err := editor.splitFile(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
+
+    var tag, textTag Tag
+    for _, chunk := range chunks {
+        switch chunk.id {
+        case "ID3 ", "id3 ":
+            if tag, err = editor.id3.parseID3v2Tags(chunk.payload()); err != nil {
+                return Tag{}, err
+            }
+        case "NAME":
+            textTag.Title = strings.Trim(string(chunk.payload()), " \x00")
+        case "AUTH":
+            textTag.Artist = strings.Trim(string(chunk.payload()), " \x00")
+        }
+    }
+
+    tag.MergeWith(textTag)
+    return tag, nil
+}
+
+func (editor *AiffTagEditor) WriteTag(src, dst string, tag Tag) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    chunks, formType, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    var existingFrames23 []id3v2Frame = nil
+    var existingFrames24 []id3v2Frame = nil
+    newChunks := newFileBuilder(file)
+
+    for _, chunk := range chunks {
+        switch chunk.id {
+        case "ID3 ", "id3 ":
+            if existingFrames23, existingFrames24, _, err = editor.id3.readID3v2Tags(chunk.payload()); err != nil {
+                return err
+            }
+        case "NAME", "AUTH":
+            break
+        default:
+            appendRiffChunk(newChunks, chunk, true)
+        }
+    }
+
+    if len(tag.Title) != 0 {
+        newChunks.appendData(makeRiffChunk("NAME", []byte(tag.Title), true))
+    }
+    if len(tag.Artist) != 0 {
+        newChunks.appendData(makeRiffChunk("AUTH", []byte(tag.Artist), true))
+    }
+    // ID3 tag without frames is not written
+    if id3Data := editor.id3.makeNewID3v2TagData(existingFrames23, existingFrames24, tag, 0); len(id3Data) > id3v2HeaderSize {
+        newChunks.appendData(makeRiffChunk("ID3 ", id3Data, true))
+    }
+
+    return saveRiffForm(file, size, dst, aiffFormMagic, formType, newChunks, true)
+}
+
+// RemoveTag removes ID3, NAME and AUTH chunks
+func (editor *AiffTagEditor) RemoveTag(src, dst string) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    chunks, formType, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    newChunks := newFileBuilder(file)
+    for _, chunk := range chunks {
+        switch chunk.id {
+        case "ID3 ", "id3 ", "NAME", "AUTH":
+            break
+        default:
+            appendRiffChunk(newChunks, chunk, true)
+        }
+    }
+
+    return saveRiffForm(file, size, dst, aiffFormMagic, formType, newChunks, true)
+}
+
+// splitFile reads chunks of the file and returns them with form type, only text and ID3 chunks payloads are loaded
+func (editor *AiffTagEditor) splitFile(file io.ReaderAt, size int64) ([]riffChunk, string, error) {
+    header, err := readAt(file, 0, riffFormHeaderSize)
+    if err != nil ||
+       string(header[0:4]) != aiffFormMagic ||
+       string(header[8:12]) != aiffFormType && string(header[8:12]) != aifcFormType {
+        return nil, "", errors.New("file is not an AIFF file")
+    }
+
+    chunks, err := readRiffFileChunks(file, size, true, func(id string) bool {
+        switch id {
+        case "ID3 ", "id3 ", "NAME", "AUTH":
+            return true
+        }
+        return false
+    })
+    return chunks, string(header[8:12]), err
+}
@@ -0,0 +1,281 @@
+package editor
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+const (
+    apeTagMagic string = "APETAGEX"
+    apeTagVersion int = 2000
+    apeTagFooterSize int = 32
+    apeItemHeaderSize int = 8
+    apeFlagHasHeader uint32 = 0x80000000
+    apeFlagIsHeader uint32 = 0x20000000
+    apeItemTypeMask int = 0x06
+    apeItemTypeBinary int = 0x02
+    apeCoverKeyPrefix string = "COVER ART ("
+)
+
+// readApeTag reads APE tag (header included) placed right before end of file, nil is returned if there is no tag
+func readApeTag(file io.ReaderAt, end int64) ([]byte, error) {
+    if end < int64(apeTagFooterSize) {
+        return nil, nil
+    }
+
+    footer, err := readAt(file, end - int64(apeTagFooterSize), apeTagFooterSize)
+    if err != nil || string(footer[0:8]) != apeTagMagic {
+        return nil, err
+    }
+
+    size := utils.ReadInt32Le(footer[12:16])
+    if uint32(utils.ReadInt32Le(footer[20:24])) & apeFlagHasHeader != 0 {
+        size += apeTagFooterSize
+    }
+    if size < apeTagFooterSize || int64(size) > end {
+        return nil, nil
+    }
+    return readAt(file, end - int64(size), size)
+}
+
+func parseApeTag(data []byte) Tag {
+    var tag Tag
+    forEachApeItem(data, func(key string, flags int, value []byte) bool {
+        parseApeItem(&tag, key, flags, value)
+        return true
+    })
+    return tag
+}
+
+func forEachApeItem(data []byte, callback func(key string, flags int, value []byte) bool) error {
+    if len(data) < apeTagFooterSize {
+        return errors.New("ape data is too short to contain a tag")
+    }
+
+    footer := data[len(data) - apeTagFooterSize:]
+    numberOfItems := utils.ReadInt32Le(footer[16:20])
+
+    data = data[:len(data) - apeTagFooterSize]
+    if len(data) >= apeTagFooterSize && string(data[0:8]) == apeTagMagic {
+        data = data[apeTagFooterSize:]
+    }
+
+    for i := 0; i < numberOfItems && len(data) > apeItemHeaderSize; i++ {
+        valueSize := utils.ReadInt32Le(data[0:4])
+        flags := utils.ReadInt32Le(data[4:8])
+        keySize := bytes.IndexByte(data[apeItemHeaderSize:], 0)
+        if keySize == -1 || len(data) < apeItemHeaderSize + keySize + 1 + valueSize {
+            return errors.New("ape item is bad formatted")
+        }
+
+        key := string(data[apeItemHeaderSize : apeItemHeaderSize + keySize])
+        value := data[apeItemHeaderSize + keySize + 1 : apeItemHeaderSize + keySize + 1 + valueSize]
+        if !callback(key, flags, value) {
+            break
+        }
+        data = data[apeItemHeaderSize + keySize + 1 + valueSize:]
+    }
+
+    return nil
+}
+
+func parseApeItem(tag *Tag, key string, flags int, value []byte) {
+    switch strings.ToUpper(key) {
+    case "TITLE":
+        tag.Title = string(value)
+    case "ARTIST":
+        // several values are null-separated
+        tag.Artist = JoinValues(strings.Split(string(value), "\x00") ...)
+    case "ALBUM":
+        tag.Album = string(value)
+    case "ALBUM ARTIST", "ALBUMARTIST":
+        tag.AlbumArtist = string(value)
+    case "TRACK":
+        tag.Track, tag.TrackTotal = parseNumberPair(string(value))
+    case "DISC":
+        tag.Disc, tag.DiscTotal = parseNumberPair(string(value))
+    case "COMPOSER":
+        tag.Composer = JoinValues(strings.Split(string(value), "\x00") ...)
+    case "PERFORMER":
+        tag.Performer = JoinValues(strings.Split(string(value), "\x00") ...)
+    case "BPM":
+        tag.BPM, _ = strconv.Atoi(string(value))
+    case "ISRC":
+        tag.ISRC = string(value)
+    case "LABEL", "PUBLISHER":
+        tag.Label = string(value)
+    case "COMPILATION":
+        tag.Compilation = string(value) == "1"
+    case "YEAR":
+        tag.Date = ParseDate(string(value))
+    case "COMMENT":
+        tag.Comment = string(value)
+    case "GENRE":
+        tag.Genre = JoinValues(strings.Split(string(value), "\x00") ...)
+    case "LYRICS":
+        setLyrics(tag, string(value))
+    default:
+        if isApeCoverItem(key, flags) {
+            if cover := parseApeCover(key, value); !cover.Empty() {
+                tag.Covers = append(tag.Covers, cover)
+            }
+        } else if flags & apeItemTypeMask == 0 && !tag.hasCustom(key) {
+            tag.SetCustom(key, string(value))
+        }
+    }
+}
+
+func isApeCoverItem(key string, flags int) bool {
+    return flags & apeItemTypeMask == apeItemTypeBinary && strings.HasPrefix(strings.ToUpper(key), apeCoverKeyPrefix)
+}
+
+func parseApeCover(key string, value []byte) Cover {
+    // binary cover item is file name, zero byte and image data
+    pos := bytes.IndexByte(value, 0)
+    if pos == -1 {
+        return Cover{}
+    }
+
+    var cover Cover
+    switch strings.ToLower(filepath.Ext(string(value[:pos]))) {
+    case ".png":
+        cover.Mime = "image/png"
+    default:
+        cover.Mime = "image/jpeg"
+    }
+    cover.Type = imageType[0]
+    for code, apeKey := range apeCoverKeys {
+        if strings.EqualFold(apeKey, key) {
+            cover.Type = imageType[code]
+        }
+    }
+    cover.Data = make([]byte, len(value) - pos - 1)
+    copy(cover.Data, value[pos + 1:])
+    return cover
+}
+
+func getUnsupportedApeItems(data []byte, tag Tag) ([]byte, int) {
+    result := make([]byte, 0, len(data))
+    items := 0
+
+    forEachApeItem(data, func(key string, flags int, value []byte) bool {
+        switch strings.ToUpper(key) {
+        case "TITLE", "ARTIST", "ALBUM", "TRACK", "YEAR", "COMMENT", "GENRE",
+             "ALBUM ARTIST", "ALBUMARTIST", "DISC", "COMPOSER", "BPM", "ISRC", "LABEL", "PUBLISHER", "COMPILATION", "LYRICS",
+             "PERFORMER":
+            break
+        default:
+            if isApeCoverItem(key, flags) || tag.hasCustom(key) {
+                break
+            }
+            result = appendApeItem(result, key, flags, value)
+            items++
+        }
+        return true
+    })
+
+    return result, items
+}
+
+func serializeApeTag(tag Tag, existingTagData []byte) []byte {
+    items, numberOfItems := getUnsupportedApeItems(existingTagData, tag)
+    newItems := make([]byte, 0, tag.Size() + 256)
+
+    addText := func(key, value string) {
+        if len(value) != 0 {
+            newItems = appendApeItem(newItems, key, 0, []byte(value))
+            numberOfItems++
+        }
+    }
+
+    addText("Title", tag.Title)
+    addText("Artist", strings.Join(SplitValues(tag.Artist), "\x00"))
+    addText("Album Artist", tag.AlbumArtist)
+    addText("Album", tag.Album)
+    if tag.Track != 0 {
+        addText("Track", formatNumberPair(tag.Track, tag.TrackTotal))
+    }
+    if tag.Disc != 0 {
+        addText("Disc", formatNumberPair(tag.Disc, tag.DiscTotal))
+    }
+    if !tag.Date.Empty() {
+        addText("Year", tag.Date.String())
+    }
+    addText("Comment", tag.Comment)
+    addText("Genre", strings.Join(SplitValues(tag.Genre), "\x00"))
+    addText("Composer", strings.Join(SplitValues(tag.Composer), "\x00"))
+    addText("Performer", strings.Join(SplitValues(tag.Performer), "\x00"))
+    if tag.BPM != 0 {
+        addText("BPM", strconv.Itoa(tag.BPM))
+    }
+    addText("ISRC", tag.ISRC)
+    addText("Label", tag.Label)
+    if tag.Compilation {
+        addText("Compilation", "1")
+    }
+    addText("Lyrics", tag.lyricsText())
+    for _, key := range tag.customKeys() {
+        addText(key, tag.Custom[key])
+    }
+    for _, cover := range tag.Covers {
+        fileName := "cover.jpg"
+        if cover.Mime == "image/png" {
+            fileName = "cover.png"
+        }
+        key, ok := apeCoverKeys[cover.TypeCode()]
+        if !ok {
+            key = apeCoverKeys[0]
+        }
+        value := append(append([]byte(fileName), 0), cover.Data ...)
+        newItems = appendApeItem(newItems, key, apeItemTypeBinary, value)
+        numberOfItems++
+    }
+
+    items = append(newItems, items ...)
+    if numberOfItems == 0 {
+        return nil
+    }
+
+    size := len(items) + apeTagFooterSize
+    result := make([]byte, 0, size + apeTagFooterSize)
+    result = append(result, makeApeTagHeader(size, numberOfItems, apeFlagHasHeader | apeFlagIsHeader) ...)
+    result = append(result, items ...)
+    result = append(result, makeApeTagHeader(size, numberOfItems, apeFlagHasHeader) ...)
+    return result
+}
+
+func appendApeItem(dst []byte, key string, flags int, value []byte) []byte {
+    header := make([]byte, apeItemHeaderSize)
+    utils.WriteInt32Le(len(value), header[0:4])
+    utils.WriteInt32Le(flags, header[4:8])
+
+    dst = append(dst, header ...)
+    dst = append(dst, key ...)
+    dst = append(dst, 0)
+    return append(dst, value ...)
+}
+
+func makeApeTagHeader(size, numberOfItems int, flags uint32) []byte {
+    header := make([]byte, apeTagFooterSize)
+    copy(header[0:8], apeTagMagic)
+    utils.WriteInt32Le(apeTagVersion, header[8:12])
+    utils.WriteInt32Le(size, header[12:16])
+    utils.WriteInt32Le(numberOfItems, header[16:20])
+    utils.WriteUint32Le(flags, header[20:24])
+    return header
+}
+
+// apeCoverKeys maps ID3v2 picture types to APE item keys
+var apeCoverKeys = map[byte]string {
+    0: "Cover Art (Other)", 1: "Cover Art (Icon)", 2: "Cover Art (Other Icon)", 3: "Cover Art (Front)", 4: "Cover Art (Back)",
+    5: "Cover Art (Leaflet)", 6: "Cover Art (Media)", 7: "Cover Art (Lead Artist)", 8: "Cover Art (Artist)", 9: "Cover Art (Conductor)",
+    10: "Cover Art (Band)", 11: "Cover Art (Composer)", 12: "Cover Art (Lyricist)", 13: "Cover Art (Recording Location)", 14: "Cover Art (During Recording)",
+    15: "Cover Art (During Performance)", 16: "Cover Art (Video Capture)", 17: "Cover Art (Fish)", 18: "Cover Art (Illustration)", 19: "Cover Art (Band Logotype)",
+    20: "Cover Art (Publisher Logotype)",
+}
@@ -0,0 +1,141 @@
+package editor
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Chapter is a named part of a long recording, zero End means the chapter lasts until the next one
+type Chapter struct {
+    Start time.Duration
+    End time.Duration
+    Title string
+}
+
+var (
+    chapterTimestamp = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2})(?:[.,](\d{1,3}))?$`)
+    chapterListingLine = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2})(?:[.,](\d{1,3}))?(?:\s+-)?\s+(.*)$`)
+    chapterVorbisLine = regexp.MustCompile(`^(?i)CHAPTER(\d+)(NAME)?=(.*)$`)
+    chapterCueIndex = regexp.MustCompile(`^(?i)INDEX\s+01\s+(\d+):(\d{1,2}):(\d{1,2})$`)
+    chapterCueTitle = regexp.MustCompile(`^(?i)TITLE\s+"?(.*?)"?$`)
+)
+
+// ParseChapters parses chapter listing, every line of which is either timestamp ([hh:]mm:ss[.fff]) followed by title,
+// or CHAPTERxxx=hh:mm:ss.fff and CHAPTERxxxNAME=title pair, or CUE sheet TRACK with its TITLE and INDEX 01
+func ParseChapters(text string) []Chapter {
+    var result []Chapter
+    numbered := make(map[int]int)
+    inCueTrack := false
+
+    for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+        line = strings.TrimSpace(line)
+        if match := chapterListingLine.FindStringSubmatch(line); match != nil {
+            start := parseChapterTime(match[1], match[2], match[3], match[4])
+            result = append(result, Chapter{Start: start, Title: strings.TrimSpace(match[5])})
+            continue
+        }
+
+        if match := chapterVorbisLine.FindStringSubmatch(line); match != nil {
+            number, _ := strconv.Atoi(match[1])
+            index, ok := numbered[number]
+            if !ok {
+                index = len(result)
+                numbered[number] = index
+                result = append(result, Chapter{})
+            }
+            if len(match[2]) != 0 {
+                result[index].Title = match[3]
+            } else {
+                result[index].Start, _ = parseChapterTimestamp(match[3])
+            }
+            continue
+        }
+
+        // CUE sheet, titles before the 1st track belong to the whole disc
+        fields := strings.Fields(line)
+        switch {
+        case len(fields) != 0 && strings.EqualFold(fields[0], "TRACK"):
+            inCueTrack = true
+            result = append(result, Chapter{})
+        case !inCueTrack:
+            break
+        case chapterCueTitle.MatchString(line):
+            result[len(result) - 1].Title = chapterCueTitle.FindStringSubmatch(line)[1]
+        case chapterCueIndex.MatchString(line):
+            match := chapterCueIndex.FindStringSubmatch(line)
+            minutes, _ := strconv.Atoi(match[1])
+            seconds, _ := strconv.Atoi(match[2])
+            frames, _ := strconv.Atoi(match[3])
+            // CUE frame is 1/75 of second
+            result[len(result) - 1].Start = time.Duration(minutes) * time.Minute + time.Duration(seconds) * time.Second +
+                                            time.Duration(frames) * time.Second / 75
+        }
+    }
+
+    sortChapters(result)
+    return result
+}
+
+// FormatChapterTimestamp formats time as hh:mm:ss.fff used by Vorbis chapters and chapter listings
+func FormatChapterTimestamp(t time.Duration) string {
+    milliseconds := int64(t / time.Millisecond)
+    return fmt.Sprintf("%02d:%02d:%02d.%03d", milliseconds / 3600000, milliseconds / 60000 % 60, milliseconds / 1000 % 60, milliseconds % 1000)
+}
+
+// parseChapterTimestamp parses [hh:]mm:ss[.fff] time
+func parseChapterTimestamp(text string) (time.Duration, bool) {
+    match := chapterTimestamp.FindStringSubmatch(strings.TrimSpace(text))
+    if match == nil {
+        return 0, false
+    }
+    return parseChapterTime(match[1], match[2], match[3], match[4]), true
+}
+
+func parseChapterTime(hours, minutes, seconds, fraction string) time.Duration {
+    var values [3]int
+    for i, text := range []string{hours, minutes, seconds} {
+        if len(text) != 0 {
+            values[i], _ = strconv.Atoi(text)
+        }
+    }
+    result := time.Duration(values[0]) * time.Hour + time.Duration(values[1]) * time.Minute + time.Duration(values[2]) * time.Second
+    if len(fraction) != 0 {
+        milliseconds, _ := strconv.Atoi(fraction)
+        for i := len(fraction); i < 3; i++ {
+            milliseconds *= 10
+        }
+        result += time.Duration(milliseconds) * time.Millisecond
+    }
+    return result
+}
+
+func sortChapters(chapters []Chapter) {
+    sort.SliceStable(chapters, func(i, j int) bool {
+        return chapters[i].Start < chapters[j].Start
+    })
+}
+
+// completeChapters returns copy of chapters with end times set, the last chapter ends with the recording,
+// or at its start if duration is unknown
+func completeChapters(chapters []Chapter, duration time.Duration) []Chapter {
+    result := make([]Chapter, len(chapters))
+    copy(result, chapters)
+    for i := range result {
+        if result[i].End > result[i].Start {
+            continue
+        }
+        switch {
+        case i + 1 < len(result):
+            result[i].End = result[i + 1].Start
+        case duration > result[i].Start:
+            result[i].End = duration
+        default:
+            result[i].End = result[i].Start
+        }
+    }
+    return result
+}
@@ -4,12 +4,23 @@ import (
     "bytes"
     "encoding/base64"
     "errors"
+    "fmt"
+    "regexp"
     "strconv"
     "strings"
 
     "github.com/mzinin/tagger/utils"
 )
 
+const (
+    frontCoverType byte = 3
+)
+
+var (
+    vorbisChapterKey = regexp.MustCompile(`^CHAPTER\d+(NAME)?$`)
+    vorbisCueTrackKey = regexp.MustCompile(`^CUE_TRACK(\d+)_(TITLE|PERFORMER)$`)
+)
+
 func parseVorbisTags(data []byte, tag *Tag) error {
     if len(data) < 4 {
         return errors.New("vorbis data is too short to contain a tag")
@@ -18,13 +29,28 @@ func parseVorbisTags(data []byte, tag *Tag) error {
     numberOfFields := utils.ReadInt32Le(data[0:4])
     data = data[4:]
 
+    // chapter start and name are separate fields, so they are collected and parsed together
+    var chapters []string
     for i := 0; i < numberOfFields; i++ {
         fieldSize := utils.ReadInt32Le(data[0:4])
         if fieldSize + 4 <= len(data) {
-            parseVorbisTagField(data[4 : 4 + fieldSize], tag)
+            field := data[4 : 4 + fieldSize]
+            if pos := bytes.IndexByte(field, 0x3d); pos != -1 && vorbisChapterKey.Match(bytes.ToUpper(field[:pos])) {
+                chapters = append(chapters, strings.Replace(string(field), "\n", " ", -1))
+            } else {
+                parseVorbisTagField(field, tag)
+            }
             data = data[4 + fieldSize:]
         }
     }
+    if len(chapters) != 0 {
+        tag.Chapters = ParseChapters(strings.Join(chapters, "\n"))
+    }
+    // some taggers use DESCRIPTION instead of COMMENT, the field itself is kept as is
+    if len(tag.Comment) == 0 && len(tag.Custom["DESCRIPTION"]) != 0 {
+        tag.Comment = tag.Custom["DESCRIPTION"]
+        tag.commentFromDescription = true
+    }
 
     return nil
 }
@@ -43,20 +69,88 @@ func parseVorbisTagField(data []byte, tag *Tag) error {
     case "TITLE":
         tag.Title = fieldValue
     case "ARTIST":
-        tag.Artist = fieldValue
+        // fields of several values are repeated
+        appendValue(&tag.Artist, fieldValue)
     case "ALBUM":
         tag.Album = fieldValue
+    case "ALBUMARTIST", "ALBUM ARTIST":
+        tag.AlbumArtist = fieldValue
     case "TRACKNUMBER":
-        tag.Track, _ = strconv.Atoi(fieldValue)
+        track, total := parseNumberPair(fieldValue)
+        tag.Track = track
+        if total != 0 {
+            tag.TrackTotal = total
+        }
+    case "TRACKTOTAL", "TOTALTRACKS":
+        tag.TrackTotal, _ = strconv.Atoi(fieldValue)
+    case "DISCNUMBER":
+        disc, total := parseNumberPair(fieldValue)
+        tag.Disc = disc
+        if total != 0 {
+            tag.DiscTotal = total
+        }
+    case "DISCTOTAL", "TOTALDISCS":
+        tag.DiscTotal, _ = strconv.Atoi(fieldValue)
     case "DATE":
-        tag.Year, _ = strconv.Atoi(fieldValue)
+        tag.Date = ParseDate(fieldValue)
+    case "ORIGINALDATE":
+        tag.OriginalDate = ParseDate(fieldValue)
+    case "ORIGINALYEAR":
+        if tag.OriginalDate.Empty() {
+            tag.OriginalDate = ParseDate(fieldValue)
+        }
+    case "COMMENT":
+        // Vorbis comments have neither language nor description
+        if len(tag.Comment) == 0 {
+            tag.Comment = fieldValue
+        } else {
+            tag.Comments = append(tag.Comments, Comment{Text: fieldValue})
+        }
     case "GENRE":
-        tag.Genre = fieldValue
+        appendValue(&tag.Genre, fieldValue)
+    case "COMPOSER":
+        appendValue(&tag.Composer, fieldValue)
+    case "PERFORMER":
+        appendValue(&tag.Performer, fieldValue)
+    case "BPM":
+        tag.BPM, _ = strconv.Atoi(fieldValue)
+    case "ISRC":
+        tag.ISRC = fieldValue
+    case "LABEL", "ORGANIZATION":
+        tag.Label = fieldValue
+    case "COMPILATION":
+        tag.Compilation = fieldValue == "1"
+    case "LYRICS":
+        // the field holds either LRC or plain text
+        if lines := ParseLrc(fieldValue); len(lines) != 0 {
+            tag.SyncedLyrics = lines
+        } else if len(tag.Lyrics) == 0 {
+            tag.Lyrics = fieldValue
+        }
+    case "UNSYNCEDLYRICS":
+        tag.Lyrics = fieldValue
+    default:
+        // titles and performers of album image tracks
+        if match := vorbisCueTrackKey.FindStringSubmatch(fieldName); match != nil {
+            number, _ := strconv.Atoi(match[1])
+            if match[2] == "TITLE" {
+                tag.CueSheet.track(number).Title = fieldValue
+            } else {
+                tag.CueSheet.track(number).Performer = fieldValue
+            }
+            break
+        }
+        // the 1st value of a field wins, the others are kept in the file while the field is not changed
+        if !tag.hasCustom(fieldName) {
+            tag.SetCustom(fieldName, fieldValue)
+        }
     case "METADATA_BLOCK_PICTURE":
-        error := parseOggTagPictureField(fieldValue, &tag.Cover)
+        var cover Cover
+        error := parseOggTagPictureField(fieldValue, &cover)
         if error != nil {
             return error
         }
+        tag.Covers = append(tag.Covers, cover)
     }
 
     return nil
@@ -95,6 +189,24 @@ func parseVorbisTagPictureField(data []byte, cover *Cover) error {
     return nil
 }
 
+// parseNumberPair parses "n" and "n/total" strings used for track and disc numbers
+func parseNumberPair(text string) (int, int) {
+    parts := strings.SplitN(strings.TrimSpace(text), "/", 2)
+    number, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+    total := 0
+    if len(parts) == 2 {
+        total, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+    }
+    return number, total
+}
+
+func formatNumberPair(number, total int) string {
+    if total == 0 {
+        return strconv.Itoa(number)
+    }
+    return strconv.Itoa(number) + "/" + strconv.Itoa(total)
+}
+
 var imageType = map[byte]string {
     0: "Other", 1:  "32x32 file icon", 2: "Other file icon", 3: "Cover (front)", 4: "Cover (back)",
     5: "Leaflet page", 6: "Media", 7: "Lead artist/lead performer/soloist", 8: "Artist/performer",  9: "Conductor",
@@ -103,10 +215,14 @@ var imageType = map[byte]string {
     20: "Publisher/Studio logotype",
 }
 
-func getUnsupportedVorbisTags(data []byte) ([]byte, int) {
+// getUnsupportedVorbisTags returns fields not covered by the tag and the tag without custom fields kept as is:
+// if a custom field has the value of the 1st field of its key, all fields of the key are kept, so repeated fields
+// are not lost, otherwise they are skipped and the custom field is written instead
+func getUnsupportedVorbisTags(data []byte, tag Tag) ([]byte, int, Tag) {
     result := make([]byte, len(data))
     fields := 0
     size := 0
+    untouched := make(map[string]bool)
 
     numberOfFields := utils.ReadInt32Le(data[0 : 4])
     data = data[4:]
@@ -124,9 +240,23 @@ func getUnsupportedVorbisTags(data []byte) ([]byte, int) {
 
         fieldName := strings.ToUpper(string(data[4 : 4 + pos]))
         switch fieldName {
-        case "TITLE", "ARTIST", "ALBUM", "TRACKNUMBER", "DATE", "GENRE", "METADATA_BLOCK_PICTURE":
+        case "TITLE", "ARTIST", "ALBUM", "TRACKNUMBER", "DATE", "GENRE", "METADATA_BLOCK_PICTURE",
+             "ALBUMARTIST", "ALBUM ARTIST", "TRACKTOTAL", "TOTALTRACKS", "DISCNUMBER", "DISCTOTAL", "TOTALDISCS",
+             "COMPOSER", "BPM", "ISRC", "LABEL", "ORGANIZATION", "COMPILATION", "LYRICS", "UNSYNCEDLYRICS",
+             "ORIGINALDATE", "ORIGINALYEAR", "COMMENT", "PERFORMER":
             break
         default:
+            if vorbisChapterKey.MatchString(fieldName) || vorbisCueTrackKey.MatchString(fieldName) {
+                break
+            }
+            if tag.hasCustom(fieldName) {
+                if _, ok := untouched[fieldName]; !ok {
+                    untouched[fieldName] = tag.Custom[fieldName] == string(data[5 + pos : 4 + fieldSize])
+                }
+                if !untouched[fieldName] {
+                    break
+                }
+            }
             copy(result[size : size + 4 + fieldSize], data[: 4 + fieldSize])
             fields++
             size += 4 + fieldSize
@@ -135,60 +265,148 @@ func getUnsupportedVorbisTags(data []byte) ([]byte, int) {
         data = data[4 + fieldSize:]
     }
 
-    return result[:size], fields
+    return result[:size], fields, tag.withoutCustom(untouched)
 }
 
 func serializeVorbisTag(tag Tag, existingFields int) ([]byte, int) {
-    // 256 bytes for possible overhead, 2* - for base64 cover encoding
-    result := make([]byte, 2*tag.Size() + 256)
-    size := 0
-    
+    // fields are appended, the capacity is just a guess: field names overhead and base64 cover encoding
+    result := make([]byte, 0, 2 * tag.Size() + 512)
+
     if len(tag.Title) != 0 {
-        size = serializeVorbisTagTextField(tag.Title, "TITLE", result, size)
+        result = serializeVorbisTagTextField(tag.Title, "TITLE", result)
         existingFields++
     }
-    if len(tag.Artist) != 0 {
-        size = serializeVorbisTagTextField(tag.Artist, "ARTIST", result, size)
+    for _, artist := range SplitValues(tag.Artist) {
+        result = serializeVorbisTagTextField(artist, "ARTIST", result)
+        existingFields++
+    }
+    if len(tag.AlbumArtist) != 0 {
+        result = serializeVorbisTagTextField(tag.AlbumArtist, "ALBUMARTIST", result)
         existingFields++
     }
     if len(tag.Album) != 0 {
-        size = serializeVorbisTagTextField(tag.Album, "ALBUM", result, size)
+        result = serializeVorbisTagTextField(tag.Album, "ALBUM", result)
         existingFields++
     }
     if tag.Track != 0 {
-        size = serializeVorbisTagTextField(strconv.Itoa(tag.Track), "TRACKNUMBER", result, size)
+        result = serializeVorbisTagTextField(strconv.Itoa(tag.Track), "TRACKNUMBER", result)
         existingFields++
     }
-    if tag.Year != 0 {
-        size = serializeVorbisTagTextField(strconv.Itoa(tag.Year), "DATE", result, size)
+    if tag.TrackTotal != 0 {
+        result = serializeVorbisTagTextField(strconv.Itoa(tag.TrackTotal), "TRACKTOTAL", result)
         existingFields++
     }
-    if len(tag.Genre) != 0 {
-        size = serializeVorbisTagTextField(tag.Genre, "GENRE", result, size)
+    if tag.Disc != 0 {
+        result = serializeVorbisTagTextField(strconv.Itoa(tag.Disc), "DISCNUMBER", result)
         existingFields++
     }
-    if !tag.Cover.Empty() {
-        data := serializeOggTagPictureField(tag.Cover)
-        size = serializeVorbisTagTextField(data, "METADATA_BLOCK_PICTURE", result, size)
+    if tag.DiscTotal != 0 {
+        result = serializeVorbisTagTextField(strconv.Itoa(tag.DiscTotal), "DISCTOTAL", result)
         existingFields++
     }
-
-    // empty tag is not allowed
-    if existingFields == 0 {
-        size = serializeVorbisTagTextField("", "LYRICS", result, size)
+    if !tag.Date.Empty() {
+        result = serializeVorbisTagTextField(tag.Date.String(), "DATE", result)
+        existingFields++
+    }
+    if !tag.OriginalDate.Empty() {
+        result = serializeVorbisTagTextField(tag.OriginalDate.String(), "ORIGINALDATE", result)
+        existingFields++
+    }
+    // unchanged comment read from DESCRIPTION is written back by the custom field only
+    if len(tag.Comment) != 0 && !(tag.commentFromDescription && tag.Comment == tag.Custom["DESCRIPTION"]) {
+        result = serializeVorbisTagTextField(tag.Comment, "COMMENT", result)
+        existingFields++
+    }
+    for _, comment := range tag.Comments {
+        if len(comment.Description) == 0 && len(comment.Text) != 0 {
+            result = serializeVorbisTagTextField(comment.Text, "COMMENT", result)
+            existingFields++
+        }
+    }
+    for _, genre := range SplitValues(tag.Genre) {
+        result = serializeVorbisTagTextField(genre, "GENRE", result)
+        existingFields++
+    }
+    for _, composer := range SplitValues(tag.Composer) {
+        result = serializeVorbisTagTextField(composer, "COMPOSER", result)
+        existingFields++
+    }
+    for _, performer := range SplitValues(tag.Performer) {
+        result = serializeVorbisTagTextField(performer, "PERFORMER", result)
+        existingFields++
+    }
+    if tag.BPM != 0 {
+        result = serializeVorbisTagTextField(strconv.Itoa(tag.BPM), "BPM", result)
+        existingFields++
+    }
+    if len(tag.ISRC) != 0 {
+        result = serializeVorbisTagTextField(tag.ISRC, "ISRC", result)
+        existingFields++
+    }
+    if len(tag.Label) != 0 {
+        result = serializeVorbisTagTextField(tag.Label, "LABEL", result)
+        existingFields++
+    }
+    if tag.Compilation {
+        result = serializeVorbisTagTextField("1", "COMPILATION", result)
+        existingFields++
+    }
+    // synced lyrics are written as LRC, plain ones are moved aside then
+    if len(tag.SyncedLyrics) != 0 {
+        result = serializeVorbisTagTextField(FormatLrc(tag.SyncedLyrics), "LYRICS", result)
+        existingFields++
+    }
+    if len(tag.Lyrics) != 0 {
+        name := "LYRICS"
+        if len(tag.SyncedLyrics) != 0 {
+            name = "UNSYNCEDLYRICS"
+        }
+        result = serializeVorbisTagTextField(tag.Lyrics, name, result)
+        existingFields++
+    }
+    for i, chapter := range tag.Chapters {
+        key := fmt.Sprintf("CHAPTER%03d", i + 1)
+        result = serializeVorbisTagTextField(FormatChapterTimestamp(chapter.Start), key, result)
+        existingFields++
+        if len(chapter.Title) != 0 {
+            result = serializeVorbisTagTextField(chapter.Title, key + "NAME", result)
+            existingFields++
+        }
+    }
+    for _, track := range tag.CueSheet.Tracks {
+        key := fmt.Sprintf("CUE_TRACK%02d_", track.Number)
+        if len(track.Title) != 0 {
+            result = serializeVorbisTagTextField(track.Title, key + "TITLE", result)
+            existingFields++
+        }
+        if len(track.Performer) != 0 {
+            result = serializeVorbisTagTextField(track.Performer, key + "PERFORMER", result)
+            existingFields++
+        }
+    }
+    for _, key := range tag.customKeys() {
+        if len(tag.Custom[key]) != 0 {
+            result = serializeVorbisTagTextField(tag.Custom[key], key, result)
+            existingFields++
+        }
+    }
+    for _, cover := range tag.Covers {
+        data := serializeOggTagPictureField(cover)
+        result = serializeVorbisTagTextField(data, "METADATA_BLOCK_PICTURE", result)
         existingFields++
     }
 
-    return result[:size], existingFields
+    return result, existingFields
 }
 
-func serializeVorbisTagTextField(text, frameName string, dst []byte, offset int) int {
-    fieldSize := len(frameName) + len(text) + 1
-    utils.WriteInt32Le(fieldSize, dst[offset : offset + 4])
-    copy(dst[offset + 4 : offset + 4 + len(frameName)], frameName)
-    dst[offset + 4 + len(frameName)] = 0x3d // '='
-    copy(dst[offset + 5 + len(frameName) : offset + 4 + fieldSize], text)
-    return offset + 4 + fieldSize
+// serializeVorbisTagTextField appends field size and NAME=value text to dst
+func serializeVorbisTagTextField(text, frameName string, dst []byte) []byte {
+    fieldSize := make([]byte, 4)
+    utils.WriteInt32Le(len(frameName) + len(text) + 1, fieldSize)
+    dst = append(dst, fieldSize ...)
+    dst = append(dst, frameName ...)
+    dst = append(dst, '=')
+    return append(dst, text ...)
 }
 
 func serializeOggTagPictureField(cover Cover) string {
@@ -200,8 +418,7 @@ func serializeVorbisTagPictureField(cover Cover) []byte {
     size := 0
 
     // cover type
-    // TODO care for cover type
-    utils.WriteInt32Be(3, result[0 : 4])
+    utils.WriteInt32Be(int(cover.TypeCode()), result[0 : 4])
     size += 4
 
     // mime
@@ -0,0 +1,69 @@
+package editor
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+)
+
+func TestVorbisMultiValues(t *testing.T) {
+    // many short values overflow the size estimated by the tag
+    artists := make([]string, 300)
+    for i := range artists {
+        artists[i] = string(rune(0x4E00 + i))
+    }
+    tag := Tag{
+        Title: "Title",
+        Artist: JoinValues(artists ...),
+        Genre: "Rock; Pop",
+        Composer: "First; Second",
+        Performer: "Singer; Guitarist",
+        Track: 1,
+        TrackTotal: 100,
+        Custom: map[string]string{"MOOD": "Calm"},
+    }
+
+    files := []struct {
+        extension string
+        editorType EditorType
+        makeFile func() []byte
+    }{
+        {"flac", Flac, makeTestFlac},
+        {"ogg", Ogg, makeTestOgg},
+    }
+    for _, file := range files {
+        t.Run(file.extension, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "test." + file.extension)
+            if err := ioutil.WriteFile(path, file.makeFile(), 0644); err != nil {
+                t.Fatal(err)
+            }
+            editor := NewEditor(file.editorType)
+            writeTestTag(t, editor, path, tag)
+
+            result, err := editor.ReadTag(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result.String() != tag.String() {
+                t.Errorf("wrong tag:\n%v\nexpected:\n%v", result, tag)
+            }
+            if len(SplitValues(result.Artist)) != len(artists) {
+                t.Errorf("%v artists, expected %v", len(SplitValues(result.Artist)), len(artists))
+            }
+        })
+    }
+}
+
+func TestSerializeVorbisTag(t *testing.T) {
+    data, fields := serializeVorbisTag(Tag{Artist: "A; B", Track: 12}, 1)
+    expected := "\x08\x00\x00\x00ARTIST=A\x08\x00\x00\x00ARTIST=B\x0e\x00\x00\x00TRACKNUMBER=12"
+    if string(data) != expected || fields != 4 {
+        t.Errorf("wrong fields %q, number %v", data, fields)
+    }
+}
+
+func TestTagSize(t *testing.T) {
+    if size := (Tag{Track: 9, TrackTotal: 10, BPM: 120}).Size(); size != 6 {
+        t.Errorf("size %v, expected 6", size)
+    }
+}
@@ -0,0 +1,165 @@
+package editor
+
+import (
+    "errors"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// CueSheet describes logical tracks of a single-file album image
+type CueSheet struct {
+    // Catalog is media catalog number of the disc
+    Catalog string
+    Tracks []CueTrack
+}
+
+// CueTrack is a logical track, Indexes hold start times of its index points:
+// index 1 is the track start and index 0 is the pregap
+type CueTrack struct {
+    Number int
+    Title string
+    Performer string
+    ISRC string
+    Indexes []CueIndex
+}
+
+type CueIndex struct {
+    Number int
+    Time time.Duration
+}
+
+func (sheet CueSheet) Empty() bool {
+    return len(sheet.Catalog) == 0 && len(sheet.Tracks) == 0
+}
+
+// hasIndexes checks if the sheet has time of any track, titles alone do not make a sheet
+func (sheet CueSheet) hasIndexes() bool {
+    for _, track := range sheet.Tracks {
+        if len(track.Indexes) != 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// track returns track by number, new track is added if there is no such one
+func (sheet *CueSheet) track(number int) *CueTrack {
+    for i := range sheet.Tracks {
+        if sheet.Tracks[i].Number == number {
+            return &sheet.Tracks[i]
+        }
+    }
+    sheet.Tracks = append(sheet.Tracks, CueTrack{Number: number})
+    sort.SliceStable(sheet.Tracks, func(i, j int) bool {
+        return sheet.Tracks[i].Number < sheet.Tracks[j].Number
+    })
+    return sheet.track(number)
+}
+
+// Start returns time of index 1, or of the 1st index if there is no index 1
+func (track CueTrack) Start() time.Duration {
+    for _, index := range track.Indexes {
+        if index.Number == 1 {
+            return index.Time
+        }
+    }
+    if len(track.Indexes) != 0 {
+        return track.Indexes[0].Time
+    }
+    return 0
+}
+
+// ParseCue parses CUE sheet of a single file, disc title, performer, date and genre are returned
+// as album, album artist, year and genre of the tag together with the sheet
+func ParseCue(text string) (Tag, error) {
+    var tag Tag
+    var track *CueTrack
+    files := 0
+
+    for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            continue
+        }
+        keyword := strings.ToUpper(fields[0])
+        value := cueValue(strings.TrimSpace(line)[len(fields[0]):])
+
+        switch {
+        case keyword == "FILE":
+            files++
+            if files > 1 {
+                return Tag{}, errors.New("CUE sheet of several files is not supported")
+            }
+        case keyword == "CATALOG":
+            tag.CueSheet.Catalog = value
+        case keyword == "TRACK":
+            if len(fields) < 2 {
+                return Tag{}, errors.New("CUE sheet track has no number")
+            }
+            number, err := strconv.Atoi(fields[1])
+            if err != nil {
+                return Tag{}, errors.New("CUE sheet track number is bad formatted")
+            }
+            track = tag.CueSheet.track(number)
+        case keyword == "TITLE" && track == nil:
+            tag.Album = value
+        case keyword == "PERFORMER" && track == nil:
+            tag.AlbumArtist = value
+        case keyword == "TITLE":
+            track.Title = value
+        case keyword == "PERFORMER":
+            track.Performer = value
+        case keyword == "ISRC" && track != nil:
+            track.ISRC = value
+        case keyword == "INDEX" && track != nil && len(fields) >= 3:
+            number, err := strconv.Atoi(fields[1])
+            indexTime, ok := parseCueTime(fields[2])
+            if err != nil || !ok {
+                return Tag{}, errors.New("CUE sheet index is bad formatted")
+            }
+            track.Indexes = append(track.Indexes, CueIndex{Number: number, Time: indexTime})
+        case keyword == "REM" && len(fields) >= 3 && track == nil:
+            // remark name is followed by its value
+            value = cueValue(value[len(fields[1]):])
+            switch strings.ToUpper(fields[1]) {
+            case "DATE":
+                tag.Date = ParseDate(value)
+            case "GENRE":
+                tag.Genre = value
+            }
+        }
+    }
+
+    if !tag.CueSheet.hasIndexes() {
+        return Tag{}, errors.New("CUE sheet has no track indexes")
+    }
+    return tag, nil
+}
+
+// cueValue trims spaces and quotes around value
+func cueValue(text string) string {
+    text = strings.TrimSpace(text)
+    if len(text) >= 2 && text[0] == '"' && text[len(text) - 1] == '"' {
+        text = text[1 : len(text) - 1]
+    }
+    return text
+}
+
+// parseCueTime parses mm:ss:ff time, frame is 1/75 of second
+func parseCueTime(text string) (time.Duration, bool) {
+    parts := strings.Split(text, ":")
+    if len(parts) != 3 {
+        return 0, false
+    }
+    var values [3]int
+    for i, part := range parts {
+        var err error
+        if values[i], err = strconv.Atoi(part); err != nil {
+            return 0, false
+        }
+    }
+    return time.Duration(values[0]) * time.Minute + time.Duration(values[1]) * time.Second +
+           time.Duration(values[2]) * time.Second / 75, true
+}
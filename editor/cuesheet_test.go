@@ -0,0 +1,69 @@
+package editor
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseCue(t *testing.T) {
+    text := "REM GENRE \"Rock\"\r\n" +
+            "REM DATE 1999\r\n" +
+            "CATALOG 1234567890123\r\n" +
+            "PERFORMER \"Album Artist\"\r\n" +
+            "TITLE \"Album\"\r\n" +
+            "FILE \"image.flac\" WAVE\r\n" +
+            "  TRACK 01 AUDIO\r\n" +
+            "    TITLE \"First\"\r\n" +
+            "    PERFORMER \"Artist\"\r\n" +
+            "    ISRC USABC1234567\r\n" +
+            "    INDEX 01 00:00:00\r\n" +
+            "  TRACK 02 AUDIO\r\n" +
+            "    TITLE Second\r\n" +
+            "    INDEX 00 03:58:50\r\n" +
+            "    INDEX 01 04:00:15\r\n"
+
+    tag, err := ParseCue(text)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tag.Album != "Album" || tag.AlbumArtist != "Album Artist" || tag.Genre != "Rock" || tag.Date != (Date{Year: 1999}) {
+        t.Errorf("wrong tag:\n%v", tag)
+    }
+    expected := CueSheet{
+        Catalog: "1234567890123",
+        Tracks: []CueTrack{
+            {Number: 1, Title: "First", Performer: "Artist", ISRC: "USABC1234567", Indexes: []CueIndex{{1, 0}}},
+            {Number: 2, Title: "Second", Indexes: []CueIndex{
+                {0, 3 * time.Minute + 58 * time.Second + 50 * time.Second / 75},
+                {1, 4 * time.Minute + time.Second / 5},
+            }},
+        },
+    }
+    if !reflect.DeepEqual(tag.CueSheet, expected) {
+        t.Errorf("wrong cue sheet %+v", tag.CueSheet)
+    }
+    if start := tag.CueSheet.Tracks[1].Start(); start != 4 * time.Minute + time.Second / 5 {
+        t.Errorf("wrong track start %v", start)
+    }
+}
+
+func TestParseCueErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+    }{
+        {"several files", "FILE a.flac WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\nFILE b.flac WAVE\n"},
+        {"no indexes", "FILE a.flac WAVE\nTRACK 01 AUDIO\nTITLE First\n"},
+        {"bad track number", "TRACK one AUDIO\nINDEX 01 00:00:00\n"},
+        {"bad index time", "TRACK 01 AUDIO\nINDEX 01 00:00\n"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if _, err := ParseCue(test.text); err == nil {
+                t.Error("no error")
+            }
+        })
+    }
+}
@@ -0,0 +1,69 @@
+package editor
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+)
+
+// Date is a release date, zero Month and Day mean they are unknown
+type Date struct {
+    Year int
+    Month int
+    Day int
+}
+
+var dateFormat = regexp.MustCompile(`^\s*(\d{4})(?:[-./](\d{1,2})(?:[-./](\d{1,2}))?)?`)
+
+// ParseDate parses yyyy, yyyy-MM or yyyy-MM-dd date, time following the date is ignored
+func ParseDate(text string) Date {
+    match := dateFormat.FindStringSubmatch(text)
+    if match == nil {
+        return Date{}
+    }
+    var date Date
+    date.Year, _ = strconv.Atoi(match[1])
+    date.Month, _ = strconv.Atoi(match[2])
+    date.Day, _ = strconv.Atoi(match[3])
+    return date.normalized()
+}
+
+// normalized drops out of range month and day, day without month is dropped as well
+func (date Date) normalized() Date {
+    if date.Month < 1 || date.Month > 12 {
+        date.Month = 0
+    }
+    if date.Month == 0 || date.Day < 1 || date.Day > 31 {
+        date.Day = 0
+    }
+    return date
+}
+
+// String formats the date as yyyy-MM-dd, unknown parts are omitted
+func (date Date) String() string {
+    date = date.normalized()
+    switch {
+    case date.Year <= 0:
+        return ""
+    case date.Month == 0:
+        return fmt.Sprintf("%04d", date.Year)
+    case date.Day == 0:
+        return fmt.Sprintf("%04d-%02d", date.Year, date.Month)
+    }
+    return fmt.Sprintf("%04d-%02d-%02d", date.Year, date.Month, date.Day)
+}
+
+func (date Date) Empty() bool {
+    return date.Year <= 0
+}
+
+// Before compares dates part by part, so unknown month or day comes first
+func (date Date) Before(other Date) bool {
+    if date.Year != other.Year {
+        return date.Year < other.Year
+    }
+    if date.Month != other.Month {
+        return date.Month < other.Month
+    }
+    return date.Day < other.Day
+}
@@ -0,0 +1,62 @@
+package editor
+
+import (
+    "testing"
+)
+
+func TestParseDate(t *testing.T) {
+    tests := []struct {
+        text string
+        expected Date
+    }{
+        {"1999", Date{Year: 1999}},
+        {"1999-12", Date{Year: 1999, Month: 12}},
+        {"1999-12-31", Date{Year: 1999, Month: 12, Day: 31}},
+        {"1999.1.2", Date{Year: 1999, Month: 1, Day: 2}},
+        {" 1999/12/31", Date{Year: 1999, Month: 12, Day: 31}},
+        {"1999-12-31T23:59:00", Date{Year: 1999, Month: 12, Day: 31}},
+        {"1999-13-01", Date{Year: 1999}},
+        {"1999-12-32", Date{Year: 1999, Month: 12}},
+        {"99", Date{}},
+        {"unknown", Date{}},
+    }
+
+    for _, test := range tests {
+        t.Run(test.text, func(t *testing.T) {
+            if date := ParseDate(test.text); date != test.expected {
+                t.Errorf("date %+v, expected %+v", date, test.expected)
+            }
+        })
+    }
+}
+
+func TestDateString(t *testing.T) {
+    tests := []struct {
+        date Date
+        expected string
+    }{
+        {Date{}, ""},
+        {Date{Year: 812}, "0812"},
+        {Date{Year: 1999, Month: 2}, "1999-02"},
+        {Date{Year: 1999, Month: 2, Day: 3}, "1999-02-03"},
+        {Date{Year: 1999, Day: 3}, "1999"},
+        {Date{Year: 1999, Month: 13, Day: 3}, "1999"},
+    }
+
+    for _, test := range tests {
+        if text := test.date.String(); text != test.expected {
+            t.Errorf("date %+v is '%v', expected '%v'", test.date, text, test.expected)
+        }
+    }
+}
+
+func TestDateBefore(t *testing.T) {
+    dates := []Date{{Year: 1998, Month: 12, Day: 31}, {Year: 1999}, {Year: 1999, Month: 1}, {Year: 1999, Month: 1, Day: 2}, {Year: 1999, Month: 2}}
+    for i := range dates {
+        for j := range dates {
+            if before := dates[i].Before(dates[j]); before != (i < j) {
+                t.Errorf("%+v before %+v: %v", dates[i], dates[j], before)
+            }
+        }
+    }
+}
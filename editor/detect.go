@@ -0,0 +1,80 @@
+package editor
+
+import (
+    "errors"
+    "io"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+// Detect identifies file format by its contents and makes the suitable editor
+func Detect(reader io.ReaderAt, options ... Options) (Editor, error) {
+    editorType, err := DetectType(reader)
+    if err != nil {
+        return nil, err
+    }
+    return NewEditor(editorType, options ...), nil
+}
+
+// DetectType identifies file format by magic bytes in the beginning of file
+func DetectType(reader io.ReaderAt) (EditorType, error) {
+    // ID3v2 tags may precede both MPEG frames and FLAC stream
+    position := int64(0)
+    for {
+        header, err := readAt(reader, position, id3v2HeaderSize)
+        if err != nil || string(header[0:3]) != id3v2TagMagic {
+            break
+        }
+        position += int64(id3v2HeaderSize + utils.ReadSyncInt32Be(header[6:10]))
+    }
+
+    header, err := readAt(reader, position, 12)
+    if err != nil {
+        if header, err = readAt(reader, position, 4); err != nil {
+            return Mp3, errors.New("file is too short to detect its format")
+        }
+    }
+
+    switch {
+    case string(header[0:4]) == flacHeaderMagic:
+        return Flac, nil
+    case position != 0 || isMpegFrameHeader(header):
+        return Mp3, nil
+    case string(header[0:4]) == oggPageMagic:
+        return Ogg, detectOggCodec(reader)
+    case len(header) < 12:
+        break
+    case string(header[4:8]) == "ftyp":
+        return M4a, nil
+    case string(header[0:4]) == wavFormMagic && string(header[8:12]) == wavFormType:
+        return Wav, nil
+    case string(header[0:4]) == aiffFormMagic && (string(header[8:12]) == aiffFormType || string(header[8:12]) == aifcFormType):
+        return Aiff, nil
+    }
+    return Mp3, errors.New("unknown file format")
+}
+
+// isMpegFrameHeader checks the header values, reserved layer 0 is used by AAC ADTS
+func isMpegFrameHeader(header []byte) bool {
+    _, ok := parseMpegFrameHeader(header)
+    return ok
+}
+
+// detectOggCodec checks that the 1st packet of Ogg stream belongs to a supported codec
+func detectOggCodec(reader io.ReaderAt) error {
+    header, err := readAt(reader, 0, oggPageHeaderSize)
+    if err != nil {
+        return err
+    }
+    magicSize := 0
+    for _, codec := range oggCodecs {
+        if len(codec.idMagic) > magicSize {
+            magicSize = len(codec.idMagic)
+        }
+    }
+    page, err := readAt(reader, 0, oggPageHeaderSize + int(header[oggPageHeaderSize - 1]) + magicSize)
+    if err != nil {
+        return err
+    }
+    return (&OggTagEditor{}).detectCodec(page)
+}
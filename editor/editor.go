@@ -4,6 +4,8 @@ package editor
 type Editor interface {
     ReadTag(path string) (Tag, error)
     WriteTag(src, dst string, tag Tag) error
+    // RemoveTag saves src into dst without any tags
+    RemoveTag(src, dst string) error
 }
 
 type EditorType int
@@ -12,16 +14,30 @@ const (
     Mp3 EditorType = iota
     Ogg
     Flac
+    M4a
+    Wav
+    Aiff
 )
 
-func NewEditor(editorType EditorType) Editor {
+func NewEditor(editorType EditorType, options ... Options) Editor {
+    editorOptions := DefaultOptions()
+    if len(options) > 0 {
+        editorOptions = options[0]
+    }
+
     switch editorType {
     case Mp3:
-        return &Mp3TagEditor{}
+        return &Mp3TagEditor{options: editorOptions}
     case Ogg:
-        return &OggTagEditor{}
+        return &OggTagEditor{options: editorOptions}
     case Flac:
-        return &FlacTagEditor{}
+        return &FlacTagEditor{options: editorOptions}
+    case M4a:
+        return &M4aTagEditor{options: editorOptions}
+    case Wav:
+        return &WavTagEditor{id3: Mp3TagEditor{options: editorOptions}}
+    case Aiff:
+        return &AiffTagEditor{id3: Mp3TagEditor{options: editorOptions}}
     }
     return nil
 }
\ No newline at end of file
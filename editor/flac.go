@@ -3,148 +3,354 @@ package editor
 import (
     "bytes"
     "errors"
-    "io/ioutil"
+    "io"
+    "os"
+    "time"
 
     "github.com/mzinin/tagger/utils"
 )
 
 const (
     flacHeaderMagic string = "fLaC"
+    streamInfoBlockType byte = 0
     commentBlockType byte = 4
+    paddingBlockType byte = 1
+    cueSheetBlockType byte = 5
     pictureBlockType byte = 6
     lastMetaBlockFlag byte = 0x80
 )
 
+const (
+    // media catalog number, lead-in samples, CD flag with reserved bytes and number of tracks
+    flacCueSheetHeaderSize int = 128 + 8 + 259 + 1
+    // offset, number, ISRC, flags with reserved bytes and number of index points
+    flacCueTrackHeaderSize int = 8 + 1 + 12 + 14 + 1
+    flacCueIndexSize int = 12
+    flacCdLeadOutTrack int = 170
+    flacLeadOutTrack int = 255
+)
+
 type FlacTagEditor struct {
-    file []byte
+    options Options
+}
+
+type flacMetaBlock struct {
+    blockType byte
+    position int64
+    size int
+    // header and block data, nil if the block is not loaded from file
+    data []byte
 }
 
 func (editor *FlacTagEditor) ReadTag(path string) (Tag, error) {
-    err := editor.readFile(path)
+    file, size, err := openFile(path)
     if err != nil {
         return Tag{}, err
     }
+    defer file.Close()
 
-    commentBlock, pictureBlock, _, _, _ := editor.splitFileData()
+    blocks, _, err := editor.splitFile(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
 
     var tag Tag
-    editor.parseCommentBlock(commentBlock, &tag)
-    editor.parsePictureBlock(pictureBlock, &tag.Cover)
-    
+    streamInfo, _, _ := editor.parseStreamInfoBlock(blocks)
+    for _, block := range blocks {
+        switch block.blockType {
+        case commentBlockType:
+            editor.parseCommentBlock(block.data, &tag)
+        case pictureBlockType:
+            var cover Cover
+            if editor.parsePictureBlock(block.data, &cover) == nil {
+                tag.Covers = append(tag.Covers, cover)
+            }
+        case cueSheetBlockType:
+            editor.parseCueSheetBlock(block.data, streamInfo.SampleRate, &tag.CueSheet)
+        }
+    }
+
     return tag, nil
 }
 
+// ReadProperties parses STREAMINFO block, bitrate is calculated by size of audio frames
+func (editor *FlacTagEditor) ReadProperties(path string) (Properties, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Properties{}, err
+    }
+    defer file.Close()
+
+    blocks, audioOffset, err := editor.splitFile(file, size)
+    if err != nil {
+        return Properties{}, err
+    }
+
+    properties, _, err := editor.parseStreamInfoBlock(blocks)
+    if err != nil {
+        return Properties{}, err
+    }
+    properties.Bitrate = averageBitrate(size - audioOffset, properties.Duration)
+    return properties, nil
+}
+
+// parseStreamInfoBlock returns properties without bitrate and total number of samples
+func (editor *FlacTagEditor) parseStreamInfoBlock(blocks []flacMetaBlock) (Properties, int64, error) {
+    for _, block := range blocks {
+        if block.blockType != streamInfoBlockType || len(block.data) < 4 + 18 {
+            continue
+        }
+        // 20 bits of sample rate, 3 bits of channels, 5 bits of bits per sample and 36 bits of total samples
+        data := block.data[4:]
+        properties := Properties{
+            Codec: "FLAC",
+            SampleRate: int(data[10]) << 12 | int(data[11]) << 4 | int(data[12]) >> 4,
+            Channels: int(data[12] >> 1) & 0x07 + 1,
+            BitDepth: (int(data[12]) & 0x01) << 4 + int(data[13]) >> 4 + 1,
+        }
+        samples := int64(data[13] & 0x0F) << 32 | int64(utils.ReadInt32Be(data[14:18]))
+        properties.Duration = samplesDuration(samples, properties.SampleRate)
+        return properties, samples, nil
+    }
+    return Properties{}, 0, errors.New("no flac stream info block")
+}
+
 func (editor *FlacTagEditor) WriteTag(src, dst string, tag Tag) error {
-    err := editor.readFile(src)
+    file, size, err := openFile(src)
     if err != nil {
         return err
     }
+    defer file.Close()
 
-    commentBlock, pictureBlock, prefix, infix, suffix := editor.splitFileData()
-
-    cover := tag.Cover
-    tag.Cover = Cover{}
-    newCommentBlock := editor.makeNewCommentBlock(tag, commentBlock)
-    newPictureBlock := editor.makeNewPictureBlock(cover)
+    blocks, audioOffset, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
 
-    // set last meta block flag on new picture block if nessesary
-    if editor.findAndRemoveLastMetaBlockFlag(commentBlock) ||
-       editor.findAndRemoveLastMetaBlockFlag(pictureBlock) ||
-       editor.findAndRemoveLastMetaBlockFlag(prefix[len(flacHeaderMagic):]) {
-        if len(newPictureBlock) > 0 {
-            newPictureBlock[0] |= lastMetaBlockFlag
-        } else if len(newCommentBlock) > 0 {
-            newCommentBlock[0] |= lastMetaBlockFlag
+    covers := tag.Covers
+    tag.Covers = nil
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+
+    // the existing cue sheet block is kept byte for byte unless the sheet is changed or removed,
+    // since lead-in and track flags of the block are not a part of the tag
+    var cueSheetBlock []byte = nil
+    cueSheetChanged := tag.hasCustom("CUESHEET")
+    if tag.CueSheet.hasIndexes() {
+        streamInfo, samples, err := editor.parseStreamInfoBlock(blocks)
+        if err != nil {
+            return err
+        }
+        cueSheetBlock = editor.makeNewCueSheetBlock(tag.CueSheet, streamInfo.SampleRate, samples)
+        cueSheetChanged = true
+        for _, block := range blocks {
+            var existing CueSheet
+            if block.blockType == cueSheetBlockType && editor.parseCueSheetBlock(block.data, streamInfo.SampleRate, &existing) == nil {
+                cueSheetChanged = !bytes.Equal(cueSheetBlock, editor.makeNewCueSheetBlock(existing, streamInfo.SampleRate, samples))
+                break
+            }
         }
     }
 
-    newData := make([]byte, len(prefix) + len(newCommentBlock) + len(newPictureBlock) + len(infix) + len(suffix))
-    copy(newData, prefix)
-    copy(newData[len(prefix):], newCommentBlock)
-    copy(newData[len(prefix) + len(newCommentBlock):], newPictureBlock)
-    copy(newData[len(prefix) + len(newCommentBlock) + len(newPictureBlock):], infix)
-    copy(newData[len(prefix) + len(newCommentBlock) + len(newPictureBlock) + len(infix):], suffix)
+    // all pictures and paddings are replaced, the new comment block takes place of the old one
+    var commentBlock []byte = nil
+    newBlocks := make([]flacMetaBlock, 0, len(blocks) + len(covers) + 2)
+    for _, block := range blocks {
+        switch block.blockType {
+        case commentBlockType:
+            if commentBlock == nil {
+                commentBlock = block.data
+                newBlocks = append(newBlocks, flacMetaBlock{data: editor.makeNewCommentBlock(tag, commentBlock)})
+            }
+        case cueSheetBlockType:
+            if !cueSheetChanged {
+                newBlocks = append(newBlocks, block)
+            }
+        case pictureBlockType, paddingBlockType:
+            break
+        default:
+            newBlocks = append(newBlocks, block)
+        }
+    }
+    if commentBlock == nil {
+        newBlocks = append(newBlocks, flacMetaBlock{data: editor.makeNewCommentBlock(tag, nil)})
+    }
+    if cueSheetChanged && cueSheetBlock != nil {
+        newBlocks = append(newBlocks, flacMetaBlock{data: cueSheetBlock})
+    }
+    for _, cover := range covers {
+        if pictureBlock := editor.makeNewPictureBlock(cover); pictureBlock != nil {
+            newBlocks = append(newBlocks, flacMetaBlock{data: pictureBlock})
+        }
+    }
 
-    return ioutil.WriteFile(dst, newData, 0666)
+    return editor.saveBlocks(file, size, dst, blocks, newBlocks, audioOffset)
 }
 
-func (editor *FlacTagEditor) readFile(path string) error {
-    var err error
-    editor.file, err = ioutil.ReadFile(path)
-    return err
+// RemoveTag removes comment and picture blocks, cue sheet describes the stream rather than tags it, so it is kept
+func (editor *FlacTagEditor) RemoveTag(src, dst string) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    blocks, audioOffset, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    newBlocks := make([]flacMetaBlock, 0, len(blocks))
+    for _, block := range blocks {
+        switch block.blockType {
+        case commentBlockType, pictureBlockType, paddingBlockType:
+            break
+        default:
+            newBlocks = append(newBlocks, block)
+        }
+    }
+
+    return editor.saveBlocks(file, size, dst, blocks, newBlocks, audioOffset)
 }
 
-func (editor *FlacTagEditor) splitFileData() ([]byte, []byte, []byte, []byte, []byte) {
-    flacBeginning := bytes.Index(editor.file, []byte(flacHeaderMagic))
-    if flacBeginning != -1 {
-        editor.file = editor.file[flacBeginning:]
+// saveBlocks replaces metadata blocks with the new ones
+func (editor *FlacTagEditor) saveBlocks(file *os.File, size int64, dst string, blocks, newBlocks []flacMetaBlock, audioOffset int64) error {
+    // overwrite only metadata if the new blocks fit into the existing ones, the rest space becomes padding
+    metaOffset := blocks[0].position
+    metaSize := audioOffset - metaOffset
+    newMetaSize := int64(0)
+    for _, block := range newBlocks {
+        newMetaSize += 4 + int64(editor.blockSize(block))
     }
-    
-    if len(editor.file) < 8 || string(editor.file[0:4]) != flacHeaderMagic {
-        return nil, nil, nil, nil, nil
+    if editor.options.InPlace && isSameFile(file, dst) && (newMetaSize == metaSize || newMetaSize + 4 <= metaSize) {
+        if newMetaSize != metaSize {
+            newBlocks = append(newBlocks, flacMetaBlock{data: editor.makePaddingBlock(int(metaSize - newMetaSize) - 4)})
+        }
+        metaData, err := editor.serializeBlocks(file, newBlocks)
+        if err != nil {
+            return err
+        }
+        return writeAt(dst, fileRegion{metaOffset, metaData})
     }
 
-    commentPosition, commentSize, picturePosition, pictureSize := editor.getSizesAndPositions()
+    if editor.options.Padding > 0 {
+        newBlocks = append(newBlocks, flacMetaBlock{data: editor.makePaddingBlock(editor.options.Padding)})
+    }
+
+    // ID3v2 tags and flac magic preceding the blocks are kept
+    builder := newFileBuilder(file)
+    builder.appendRange(0, metaOffset)
+    editor.appendBlocks(builder, newBlocks)
+    builder.appendRange(audioOffset, size - audioOffset)
+
+    return builder.save(dst)
+}
 
-    if commentPosition == 0 && picturePosition == 0 {
-        return nil, nil, editor.file, nil, nil
+func (editor *FlacTagEditor) blockSize(block flacMetaBlock) int {
+    if block.data != nil {
+        return len(block.data) - 4
     }
-    if commentPosition == 0 {
-        return nil, editor.file[picturePosition : picturePosition + pictureSize], editor.file[:picturePosition], nil, editor.file[picturePosition + pictureSize:]
+    return block.size
+}
+
+// appendBlocks appends blocks to new file setting last block flag on the last of them only
+func (editor *FlacTagEditor) appendBlocks(builder *fileBuilder, blocks []flacMetaBlock) {
+    for i, block := range blocks {
+        builder.appendData(editor.makeBlockHeader(block, i == len(blocks) - 1))
+        if block.data != nil {
+            builder.appendData(block.data[4:])
+        } else {
+            builder.appendRange(block.position + 4, int64(block.size))
+        }
     }
-    if picturePosition == 0 {
-        return editor.file[commentPosition : commentPosition + commentSize], nil, editor.file[:commentPosition], nil, editor.file[commentPosition + commentSize:]
+}
+
+// serializeBlocks makes metadata blocks in memory, not loaded blocks are read from file
+func (editor *FlacTagEditor) serializeBlocks(file io.ReaderAt, blocks []flacMetaBlock) ([]byte, error) {
+    result := make([]byte, 0, 4096)
+    for i, block := range blocks {
+        if block.data == nil {
+            var err error
+            if block.data, err = readAt(file, block.position, 4 + block.size); err != nil {
+                return nil, err
+            }
+        }
+        result = append(result, editor.makeBlockHeader(block, i == len(blocks) - 1) ...)
+        result = append(result, block.data[4:] ...)
     }
+    return result, nil
+}
 
-    firstPosition := commentPosition
-    firstSize := commentSize
-    secondPosition := picturePosition
-    secondSize := pictureSize
-    if commentPosition > picturePosition {
-        firstPosition = picturePosition
-        firstSize = pictureSize
-        secondPosition = commentPosition
-        secondSize = commentSize
+func (editor *FlacTagEditor) makeBlockHeader(block flacMetaBlock, last bool) []byte {
+    header := make([]byte, 4)
+    if block.data != nil {
+        copy(header, block.data[0:4])
+    } else {
+        header[0] = block.blockType
+        utils.WriteInt24Be(block.size, header[1:4])
+    }
+    header[0] &= ^lastMetaBlockFlag
+    if last {
+        header[0] |= lastMetaBlockFlag
     }
+    return header
+}
 
-    return editor.file[commentPosition : commentPosition + commentSize],
-           editor.file[picturePosition : picturePosition + pictureSize],
-           editor.file[:firstPosition],
-           editor.file[firstPosition + firstSize : secondPosition],
-           editor.file[secondPosition + secondSize:]
+func (editor *FlacTagEditor) makePaddingBlock(size int) []byte {
+    block := make([]byte, 4 + size)
+    block[0] = paddingBlockType
+    utils.WriteInt24Be(size, block[1:4])
+    return block
 }
 
-func (editor *FlacTagEditor) getSizesAndPositions() (int, int, int, int) {
-    commentPosition := 0
-    commentSize := 0
-    picturePosition := 0
-    pictureSize := 0
+// splitFile reads metadata blocks headers and returns them with position of audio frames,
+// only stream info, comment and picture blocks are loaded
+func (editor *FlacTagEditor) splitFile(file io.ReaderAt, size int64) ([]flacMetaBlock, int64, error) {
+    // ID3v2 tags in the beginning of file are skipped
+    position := int64(0)
+    for {
+        header, err := readAt(file, position, id3v2HeaderSize)
+        if err != nil || string(header[0:3]) != id3v2TagMagic {
+            break
+        }
+        position += int64(id3v2HeaderSize + utils.ReadSyncInt32Be(header[6:10]))
+    }
+
+    magic, err := readAt(file, position, len(flacHeaderMagic))
+    if err != nil || string(magic) != flacHeaderMagic {
+        return nil, 0, errors.New("file is not a flac file")
+    }
+    position += int64(len(flacHeaderMagic))
 
-    data := editor.file[4:]
+    blocks := make([]flacMetaBlock, 0, 8)
     lastBlock := false
-    currentPosition := 4
 
-    for len(data) > 3 && !lastBlock {
-        blockType := data[0] & (^lastMetaBlockFlag)
-        blockSize := utils.ReadInt24Be(data[1:4]) + 4
+    for !lastBlock {
+        header, err := readAt(file, position, 4)
+        if err != nil {
+            return nil, 0, err
+        }
 
-        switch blockType {
-        case commentBlockType:
-            commentPosition = currentPosition
-            commentSize = blockSize
-        case pictureBlockType:
-            if blockSize > pictureSize {
-                picturePosition = currentPosition
-                pictureSize = blockSize
+        block := flacMetaBlock{
+            blockType: header[0] & (^lastMetaBlockFlag),
+            position: position,
+            size: utils.ReadInt24Be(header[1:4]),
+        }
+        if position + 4 + int64(block.size) > size {
+            return nil, 0, errors.New("flac meta block is truncated")
+        }
+        switch block.blockType {
+        case streamInfoBlockType, commentBlockType, pictureBlockType, cueSheetBlockType:
+            if block.data, err = readAt(file, position, 4 + block.size); err != nil {
+                return nil, 0, err
             }
         }
 
-        lastBlock = data[0] & lastMetaBlockFlag == lastMetaBlockFlag
-        currentPosition += blockSize
-        data = data[blockSize:]
+        blocks = append(blocks, block)
+        lastBlock = header[0] & lastMetaBlockFlag == lastMetaBlockFlag
+        position += 4 + int64(block.size)
     }
 
-    return commentPosition, commentSize, picturePosition, pictureSize
+    return blocks, position, nil
 }
 
 func (editor *FlacTagEditor) parseCommentBlock(data []byte, tag *Tag) error {
@@ -153,7 +359,9 @@ func (editor *FlacTagEditor) parseCommentBlock(data []byte, tag *Tag) error {
     }
 
     vendorSize := utils.ReadInt32Le(data[4:8])
-    return parseVorbisTags(data[8 + vendorSize:], tag)
+    err := parseVorbisTags(data[8 + vendorSize:], tag)
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+    return err
 }
 
 func (editor *FlacTagEditor) parsePictureBlock(data []byte, cover *Cover) error {
@@ -164,15 +372,111 @@ func (editor *FlacTagEditor) parsePictureBlock(data []byte, cover *Cover) error
     return parseVorbisTagPictureField(data[4:], cover)
 }
 
+// parseCueSheetBlock reads media catalog number and tracks with their ISRC and index points, lead-out track is skipped
+func (editor *FlacTagEditor) parseCueSheetBlock(data []byte, sampleRate int, sheet *CueSheet) error {
+    // catalog, lead-in samples, flags and reserved bytes, number of tracks
+    if len(data) < 4 + flacCueSheetHeaderSize || sampleRate == 0 {
+        return errors.New("flac cue sheet block is bad formatted")
+    }
+    data = data[4:]
+    sheet.Catalog = string(bytes.TrimRight(data[0:128], "\x00"))
+    tracks := int(data[flacCueSheetHeaderSize - 1])
+    data = data[flacCueSheetHeaderSize:]
+
+    for i := 0; i < tracks && len(data) >= flacCueTrackHeaderSize; i++ {
+        offset := utils.ReadInt64Be(data[0:8])
+        number := int(data[8])
+        isrc := string(bytes.TrimRight(data[9:21], "\x00"))
+        indexes := int(data[flacCueTrackHeaderSize - 1])
+        data = data[flacCueTrackHeaderSize:]
+        if len(data) < indexes * flacCueIndexSize {
+            return errors.New("flac cue sheet track is truncated")
+        }
+
+        if number != flacCdLeadOutTrack && number != flacLeadOutTrack {
+            track := sheet.track(number)
+            track.ISRC = isrc
+            track.Indexes = nil
+            for j := 0; j < indexes; j++ {
+                // index offset is relative to track offset
+                indexOffset := offset + utils.ReadInt64Be(data[j * flacCueIndexSize : j * flacCueIndexSize + 8])
+                track.Indexes = append(track.Indexes, CueIndex{
+                    Number: int(data[j * flacCueIndexSize + 8]),
+                    Time: samplesDuration(indexOffset, sampleRate),
+                })
+            }
+        }
+        data = data[indexes * flacCueIndexSize:]
+    }
+    return nil
+}
+
+// makeNewCueSheetBlock makes cue sheet with tracks having index points and lead-out track ending the stream,
+// the sheet is marked as CD one if all index points are on CD frames
+func (editor *FlacTagEditor) makeNewCueSheetBlock(sheet CueSheet, sampleRate int, totalSamples int64) []byte {
+    toSamples := func(t time.Duration) int64 {
+        return (int64(t) * int64(sampleRate) + int64(time.Second) / 2) / int64(time.Second)
+    }
+
+    isCd := sampleRate == 44100
+    var tracks []CueTrack
+    for _, track := range sheet.Tracks {
+        if len(track.Indexes) == 0 {
+            continue
+        }
+        tracks = append(tracks, track)
+        for _, index := range track.Indexes {
+            // CD frame is 1/75 of second
+            isCd = isCd && toSamples(index.Time) % (44100 / 75) == 0 && track.Number <= 99
+        }
+    }
+
+    block := make([]byte, 4 + flacCueSheetHeaderSize)
+    block[0] = cueSheetBlockType
+    copy(block[4:132], sheet.Catalog)
+    if isCd {
+        // 2 seconds of lead-in
+        utils.WriteInt64Be(88200, block[132:140])
+        block[140] = 0x80
+    }
+    block[len(block) - 1] = byte(len(tracks) + 1)
+
+    leadOut := CueTrack{Number: flacLeadOutTrack}
+    if isCd {
+        leadOut.Number = flacCdLeadOutTrack
+    }
+    for _, track := range append(tracks, leadOut) {
+        trackData := make([]byte, flacCueTrackHeaderSize + len(track.Indexes) * flacCueIndexSize)
+        offset := totalSamples
+        if len(track.Indexes) != 0 {
+            offset = toSamples(track.Indexes[0].Time)
+        }
+        utils.WriteInt64Be(offset, trackData[0:8])
+        trackData[8] = byte(track.Number)
+        copy(trackData[9:21], track.ISRC)
+        trackData[flacCueTrackHeaderSize - 1] = byte(len(track.Indexes))
+        for i, index := range track.Indexes {
+            indexData := trackData[flacCueTrackHeaderSize + i * flacCueIndexSize:]
+            utils.WriteInt64Be(toSamples(index.Time) - offset, indexData[0:8])
+            indexData[8] = byte(index.Number)
+        }
+        block = append(block, trackData ...)
+    }
+
+    utils.WriteInt24Be(len(block) - 4, block[1:4])
+    return block
+}
+
 func (editor *FlacTagEditor) makeNewCommentBlock(tag Tag, existingCommentBlock []byte) []byte {
-    var vendorData []byte = nil
+    // empty vendor string by default
+    vendorData := make([]byte, 4)
     var unsupportedTagData []byte = nil
     var unsupportedFields int = 0
 
     if len(existingCommentBlock) >= 8 {
         vendorSize := utils.ReadInt32Le(existingCommentBlock[4:8])
         vendorData = existingCommentBlock[4 : 8 + vendorSize]
-        unsupportedTagData, unsupportedFields = getUnsupportedVorbisTags(existingCommentBlock[8 + vendorSize:])
+        unsupportedTagData, unsupportedFields, tag = getUnsupportedVorbisTags(existingCommentBlock[8 + vendorSize:], tag)
     }
 
     newCommentData, totalFields := serializeVorbisTag(tag, unsupportedFields)
@@ -201,15 +505,3 @@ func (editor *FlacTagEditor) makeNewPictureBlock(cover Cover) []byte {
 
     return append(typeData, pictureData ...)
 }
-
-func (editor *FlacTagEditor) findAndRemoveLastMetaBlockFlag(blocks []byte) bool {
-    for len(blocks) > 3 {
-        if blocks[0] & lastMetaBlockFlag == lastMetaBlockFlag {
-            blocks[0] &= (^lastMetaBlockFlag)
-            return true
-        }
-        blockSize := utils.ReadInt24Be(blocks[1:4]) + 4
-        blocks = blocks[blockSize:]
-    }
-    return false
-}
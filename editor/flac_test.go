@@ -0,0 +1,98 @@
+package editor
+
+import (
+    "bytes"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestFlacLeadingID3v2(t *testing.T) {
+    id3v2 := (&Mp3TagEditor{options: DefaultOptions()}).makeNewID3v2TagData(nil, nil, Tag{Title: "id3"}, 0)
+    path := filepath.Join(t.TempDir(), "test.flac")
+    if err := ioutil.WriteFile(path, append(append([]byte{}, id3v2 ...), makeTestFlac() ...), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    editor := NewEditor(Flac)
+    tag := Tag{Title: "Title", Artist: "Artist"}
+    writeTestTag(t, editor, path, tag)
+    checkTestTag(t, editor, path, tag)
+    checkTestAudio(t, path)
+
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.HasPrefix(data, append(id3v2, flacHeaderMagic ...)) {
+        t.Error("ID3v2 tag is lost")
+    }
+}
+
+// makeTestFlacWithCueSheet makes STREAMINFO and CD cue sheet of 2 tracks, the 1st track is marked as non-audio one,
+// it returns the file and the cue sheet block
+func makeTestFlacWithCueSheet() ([]byte, []byte) {
+    editor := &FlacTagEditor{options: DefaultOptions()}
+    block := editor.makeNewCueSheetBlock(CueSheet{Tracks: []CueTrack{
+        {Number: 1, Indexes: []CueIndex{{1, 0}}},
+        {Number: 2, Indexes: []CueIndex{{1, 2 * time.Second}}},
+    }}, 44100, 44100 * 4)
+    block[0] |= lastMetaBlockFlag
+    block[4 + flacCueSheetHeaderSize + 21] |= 0x80
+
+    data := makeTestFlac()
+    data[4] &^= lastMetaBlockFlag
+    streamInfoEnd := 8 + 34
+    result := append(append(append([]byte{}, data[:streamInfoEnd] ...), block ...), data[streamInfoEnd:] ...)
+    return result, block[4:]
+}
+
+func TestFlacCueSheetBlock(t *testing.T) {
+    changed := CueSheet{Tracks: []CueTrack{
+        {Number: 1, Indexes: []CueIndex{{1, 0}}},
+        {Number: 2, Indexes: []CueIndex{{1, 3 * time.Second}}},
+    }}
+    removed := Tag{Title: "Title"}
+    removed.RemoveField("cuesheet")
+    tests := []struct {
+        name string
+        tag func(tag Tag) Tag
+        kept bool
+        tracks int
+    }{
+        {"same sheet", func(tag Tag) Tag { tag.Title = "Title"; return tag }, true, 2},
+        {"no sheet", func(Tag) Tag { return Tag{Title: "Title"} }, true, 2},
+        {"changed sheet", func(Tag) Tag { return Tag{Title: "Title", CueSheet: changed} }, false, 2},
+        {"removed sheet", func(Tag) Tag { return removed }, false, 0},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            data, block := makeTestFlacWithCueSheet()
+            path := filepath.Join(t.TempDir(), "test.flac")
+            if err := ioutil.WriteFile(path, data, 0644); err != nil {
+                t.Fatal(err)
+            }
+            editor := NewEditor(Flac)
+            tag, err := editor.ReadTag(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            writeTestTag(t, editor, path, test.tag(tag))
+
+            if data, err = ioutil.ReadFile(path); err != nil {
+                t.Fatal(err)
+            }
+            if kept := bytes.Contains(data, block); kept != test.kept {
+                t.Errorf("cue sheet block is kept: %v, expected: %v", kept, test.kept)
+            }
+            if tag, err = editor.ReadTag(path); err != nil {
+                t.Fatal(err)
+            }
+            if len(tag.CueSheet.Tracks) != test.tracks || tag.Title != "Title" {
+                t.Errorf("wrong tag:\n%v", tag)
+            }
+        })
+    }
+}
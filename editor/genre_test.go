@@ -0,0 +1,67 @@
+package editor
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestNormalizeGenre(t *testing.T) {
+    aliases := map[string]string{"hip hop": "Hip-Hop", "hip-hop": "Hip-Hop", "synth pop": "Synthpop"}
+    tests := []struct {
+        name string
+        genres GenreMap
+        text string
+        expected string
+    }{
+        {"code", GenreMap{}, "17", "Rock"},
+        {"reference", GenreMap{}, "(17)", "Rock"},
+        {"references and name", GenreMap{}, "(17)(13)Rock", "Rock; Pop"},
+        {"Winamp extension", GenreMap{}, "(147)", "Synthpop"},
+        {"remix and cover", GenreMap{}, "(RX)(CR)", "Remix; Cover"},
+        {"parenthesis", GenreMap{}, "((Unknown) genre", "(Unknown) genre"},
+        {"separators", GenreMap{}, "rock;pop\x00Jazz", "Rock; Pop; Jazz"},
+        {"unknown code", GenreMap{}, "(255)", "(255)"},
+        {"aliases", GenreMap{Aliases: aliases}, "hip hop; HIP-HOP; synth pop", "Hip-Hop; Synthpop"},
+        {"strict", GenreMap{Aliases: aliases, Strict: true}, "Rock; hip hop; Unknown", "Hip-Hop"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if genre := test.genres.Normalize(test.text); genre != test.expected {
+                t.Errorf("genre '%v', expected '%v'", genre, test.expected)
+            }
+        })
+    }
+}
+
+func TestReadGenreMap(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "genres.txt")
+    if err := ioutil.WriteFile(path, []byte("# comment\r\nHip-Hop = hip hop, hiphop\r\n\r\nRock\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    genres, err := ReadGenreMap(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := map[string]string{"hip-hop": "Hip-Hop", "hip hop": "Hip-Hop", "hiphop": "Hip-Hop", "rock": "Rock"}
+    if !reflect.DeepEqual(genres.Aliases, expected) || genres.Strict {
+        t.Errorf("wrong genre map %+v", genres)
+    }
+
+    if err := ioutil.WriteFile(path, []byte("= alias"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ReadGenreMap(path); err == nil {
+        t.Error("no error for mapping without genre")
+    }
+}
+
+func TestID3v2Genre(t *testing.T) {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    frames := []id3v2Frame{editor.makeID3v2TextFrame("TCON", 4, "(17)(13)", "52", "Synth Pop")}
+    if tag := editor.parseID3v2Tag(frames, 4); tag.Genre != "Rock; Pop; Electronic; Synth Pop" {
+        t.Errorf("genre '%v'", tag.Genre)
+    }
+}
@@ -0,0 +1,1056 @@
+package editor
+
+import (
+    "bytes"
+    "compress/zlib"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+const (
+    id3v22FrameHeaderSize int = 6
+    // role of performers in IPLS and TMCL frames written by the editor
+    id3v2PerformerRole string = "performer"
+)
+
+type id3v2Frame struct {
+    id string
+    flags [2]byte
+    data []byte
+}
+
+// readID3v2Tags reads all ID3v2 tags in the beginning of data and returns their frames
+// together with total size of the tags, frames of ID3v2.2 tags are returned as ID3v2.3 ones
+func (editor *Mp3TagEditor) readID3v2Tags(data []byte) ([]id3v2Frame, []id3v2Frame, int, error) {
+    var frames23 []id3v2Frame = nil
+    var frames24 []id3v2Frame = nil
+    size := 0
+
+    for len(data) - size >= id3v2HeaderSize && string(data[size : size + 3]) == id3v2TagMagic {
+        header := data[size : size + id3v2HeaderSize]
+        tagSize := editor.readSyncInt32Be(header[6:10])
+        if len(data) - size < id3v2HeaderSize + tagSize {
+            return nil, nil, 0, errors.New("ID3v2 tag is truncated")
+        }
+
+        frames, err := editor.readID3v2Tag(header, data[size + id3v2HeaderSize : size + id3v2HeaderSize + tagSize])
+        if err != nil {
+            return nil, nil, 0, err
+        }
+
+        switch header[3] {
+        case 2, 3:
+            frames23 = append(frames23, frames ...)
+        case 4:
+            frames24 = append(frames24, frames ...)
+        }
+
+        size += id3v2HeaderSize + tagSize
+        // ID3v2.4 footer is not included into tag size
+        if header[3] == 4 && header[5] & 0x10 != 0 {
+            size += id3v2HeaderSize
+        }
+    }
+
+    if size > len(data) {
+        size = len(data)
+    }
+    return frames23, frames24, size, nil
+}
+
+func (editor *Mp3TagEditor) readID3v2Tag(header, data []byte) ([]id3v2Frame, error) {
+    version := int(header[3])
+    flags := header[5]
+
+    switch version {
+    case 2:
+        if flags & 0x40 != 0 {
+            return nil, errors.New("ID3v2.2 compression is not supported")
+        }
+        if flags & 0x80 != 0 {
+            data = editor.removeUnsynchronisation(data)
+        }
+        return editor.readID3v22Frames(data)
+
+    case 3:
+        if flags & 0x1F != 0 {
+            return nil, fmt.Errorf("unknown ID3v2.3 tag flags %x", flags)
+        }
+        if flags & 0x80 != 0 {
+            data = editor.removeUnsynchronisation(data)
+        }
+        if flags & 0x40 != 0 {
+            if len(data) < 4 || len(data) < 4 + utils.ReadInt32Be(data[0:4]) {
+                return nil, errors.New("ID3v2.3 extended header is bad formatted")
+            }
+            data = data[4 + utils.ReadInt32Be(data[0:4]):]
+        }
+        return editor.readID3v2Frames(data, version, false)
+
+    case 4:
+        if flags & 0x0F != 0 {
+            return nil, fmt.Errorf("unknown ID3v2.4 tag flags %x", flags)
+        }
+        if flags & 0x40 != 0 {
+            if len(data) < 4 || len(data) < editor.readSyncInt32Be(data[0:4]) {
+                return nil, errors.New("ID3v2.4 extended header is bad formatted")
+            }
+            data = data[editor.readSyncInt32Be(data[0:4]):]
+        }
+        return editor.readID3v2Frames(data, version, flags & 0x80 != 0)
+    }
+
+    utils.Log(utils.WARNING, "ID3v2.%v tag is not supported and skipped", version)
+    return nil, nil
+}
+
+func (editor *Mp3TagEditor) readID3v2Frames(data []byte, version int, unsynchronised bool) ([]id3v2Frame, error) {
+    result := make([]id3v2Frame, 0, 16)
+
+    for len(data) > id3v2FrameHeaderSize {
+        frameId := string(data[0:4])
+        if frameId == "\x00\x00\x00\x00" {
+            break
+        }
+
+        frameSize := 0
+        switch version {
+        case 3:
+            frameSize = utils.ReadInt32Be(data[4:8])
+        case 4:
+            frameSize = editor.readSyncInt32Be(data[4:8])
+        }
+        if len(data) < id3v2FrameHeaderSize + frameSize {
+            return nil, fmt.Errorf("ID3v2 frame '%v' is truncated", frameId)
+        }
+
+        frame, err := editor.decodeID3v2Frame(id3v2Frame{
+            id: frameId,
+            flags: [2]byte{data[8], data[9]},
+            data: data[id3v2FrameHeaderSize : id3v2FrameHeaderSize + frameSize],
+        }, version, unsynchronised)
+        if err != nil {
+            return nil, err
+        }
+
+        result = append(result, frame)
+        data = data[id3v2FrameHeaderSize + frameSize:]
+    }
+
+    return result, nil
+}
+
+// decodeID3v2Frame undoes frame level unsynchronisation and compression and drops grouping identity,
+// so the returned frame has no format flags
+func (editor *Mp3TagEditor) decodeID3v2Frame(frame id3v2Frame, version int, unsynchronised bool) (id3v2Frame, error) {
+    flags := frame.flags[1]
+    headerSize := 0
+    compressed := false
+
+    switch version {
+    case 3:
+        if flags & 0x1F != 0 {
+            return frame, fmt.Errorf("ID3v2.3 frame '%v' has unknown flags %x", frame.id, flags)
+        }
+        if flags & 0x40 != 0 {
+            return frame, fmt.Errorf("ID3v2.3 frame '%v' is encrypted, encryption is not supported", frame.id)
+        }
+        if flags & 0x80 != 0 {
+            headerSize += 4 // decompressed size
+            compressed = true
+        }
+        if flags & 0x20 != 0 {
+            headerSize++ // group identifier
+        }
+
+    case 4:
+        if flags & 0xB0 != 0 {
+            return frame, fmt.Errorf("ID3v2.4 frame '%v' has unknown flags %x", frame.id, flags)
+        }
+        if flags & 0x04 != 0 {
+            return frame, fmt.Errorf("ID3v2.4 frame '%v' is encrypted, encryption is not supported", frame.id)
+        }
+        if flags & 0x08 != 0 && flags & 0x01 == 0 {
+            return frame, fmt.Errorf("ID3v2.4 frame '%v' is compressed without data length indicator", frame.id)
+        }
+        if flags & 0x40 != 0 {
+            headerSize++ // group identifier
+        }
+        if flags & 0x01 != 0 {
+            headerSize += 4 // data length indicator
+        }
+        unsynchronised = unsynchronised || flags & 0x02 != 0
+        compressed = flags & 0x08 != 0
+    }
+
+    if len(frame.data) < headerSize {
+        return frame, fmt.Errorf("ID3v2 frame '%v' is too short for its flags", frame.id)
+    }
+    frame.data = frame.data[headerSize:]
+
+    if unsynchronised {
+        frame.data = editor.removeUnsynchronisation(frame.data)
+    }
+    if compressed {
+        reader, err := zlib.NewReader(bytes.NewReader(frame.data))
+        if err != nil {
+            return frame, fmt.Errorf("failed to decompress ID3v2 frame '%v': %v", frame.id, err)
+        }
+        frame.data, err = ioutil.ReadAll(reader)
+        reader.Close()
+        if err != nil {
+            return frame, fmt.Errorf("failed to decompress ID3v2 frame '%v': %v", frame.id, err)
+        }
+    }
+
+    frame.flags[1] = 0
+    return frame, nil
+}
+
+func (editor *Mp3TagEditor) removeUnsynchronisation(data []byte) []byte {
+    return bytes.Replace(data, []byte{0xFF, 0x00}, []byte{0xFF}, -1)
+}
+
+// readID3v22Frames reads ID3v2.2 frames (3 bytes id and size, no flags) and converts them into ID3v2.3 ones
+func (editor *Mp3TagEditor) readID3v22Frames(data []byte) ([]id3v2Frame, error) {
+    result := make([]id3v2Frame, 0, 16)
+
+    // zero byte starts padding
+    for len(data) > 0 && data[0] != 0 {
+        if len(data) < id3v22FrameHeaderSize {
+            return nil, errors.New("ID3v2.2 frame header is truncated")
+        }
+        frameId := string(data[0:3])
+
+        frameSize := utils.ReadInt24Be(data[3:6])
+        if len(data) < id3v22FrameHeaderSize + frameSize {
+            return nil, fmt.Errorf("ID3v2.2 frame '%v' is truncated", frameId)
+        }
+        frameData := data[id3v22FrameHeaderSize : id3v22FrameHeaderSize + frameSize]
+        data = data[id3v22FrameHeaderSize + frameSize:]
+
+        newFrameId, ok := id3v22FrameIds[frameId]
+        if !ok {
+            utils.Log(utils.DEBUG, "ID3v2.2 frame '%v' has no ID3v2.3 equivalent and skipped", frameId)
+            continue
+        }
+
+        // PIC has 3 characters image format instead of MIME type
+        if frameId == "PIC" && len(frameData) > 4 {
+            mime := "image/" + strings.ToLower(string(frameData[1:4]))
+            if mime == "image/jpg" {
+                mime = "image/jpeg"
+            }
+            frameData = append(append([]byte{frameData[0]}, append([]byte(mime), 0) ...), frameData[4:] ...)
+        }
+
+        result = append(result, id3v2Frame{id: newFrameId, data: frameData})
+    }
+
+    return result, nil
+}
+
+// makeNewID3v2TagData makes ID3v2 tag followed by padding zero bytes, which are included into the tag size
+func (editor *Mp3TagEditor) makeNewID3v2TagData(existingFrames23, existingFrames24 []id3v2Frame, tag Tag, padding int) []byte {
+    version := editor.options.ID3v2Version
+    if version != 4 {
+        version = 3
+    }
+
+    // frames of both existing tags are preserved, the 1st occurence of a frame wins
+    existingFrames := editor.convertID3v2Frames(existingFrames23, 3, version)
+    ids := make(map[string]bool)
+    for _, frame := range existingFrames {
+        ids[editor.id3v2FrameKey(frame)] = true
+    }
+    for _, frame := range editor.convertID3v2Frames(existingFrames24, 4, version) {
+        if !ids[editor.id3v2FrameKey(frame)] {
+            existingFrames = append(existingFrames, frame)
+        }
+    }
+
+    unsupportedFrames := editor.getUnsupportedID3v2Frames(existingFrames, tag)
+    for i, frame := range unsupportedFrames {
+        unsupportedFrames[i] = editor.reencodeID3v2LegacyText(frame, version)
+    }
+    frames := append(editor.makeID3v2Frames(tag, existingFrames, version), unsupportedFrames ...)
+    data := editor.serializeID3v2Frames(frames, version)
+    if padding > 0 {
+        data = append(data, make([]byte, padding) ...)
+    }
+    return append(editor.makeID3v2TagHeader(len(data), version), data ...)
+}
+
+func (editor *Mp3TagEditor) makeID3v2Frames(tag Tag, existingFrames []id3v2Frame, version int) []id3v2Frame {
+    result := make([]id3v2Frame, 0, 8)
+
+    if len(tag.Title) != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TIT2", version, tag.Title))
+    }
+    if len(tag.Artist) != 0 {
+        result = append(result, editor.makeID3v2ValuesFrame("TPE1", version, tag.Artist))
+    }
+    if len(tag.AlbumArtist) != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TPE2", version, tag.AlbumArtist))
+    }
+    if len(tag.Album) != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TALB", version, tag.Album))
+    }
+    if tag.Track != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TRCK", version, formatNumberPair(tag.Track, tag.TrackTotal)))
+    }
+    if tag.Disc != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TPOS", version, formatNumberPair(tag.Disc, tag.DiscTotal)))
+    }
+    if !tag.Date.Empty() {
+        date := tag.Date.String()
+        switch version {
+        case 4:
+            // keep full recording time if it is still the same date
+            for _, frame := range existingFrames {
+                if frame.id == "TDRC" && strings.HasPrefix(editor.readID3v2Text(frame.data), date) {
+                    date = editor.readID3v2Text(frame.data)
+                }
+            }
+            result = append(result, editor.makeID3v2TextFrame("TDRC", version, date))
+        default:
+            result = append(result, editor.makeID3v2TextFrame("TYER", version, date[0:4]))
+            if len(date) == 10 {
+                result = append(result, editor.makeID3v2TextFrame("TDAT", version, date[8:10] + date[5:7]))
+            }
+        }
+    }
+    if !tag.OriginalDate.Empty() {
+        switch version {
+        case 4:
+            result = append(result, editor.makeID3v2TextFrame("TDOR", version, tag.OriginalDate.String()))
+        default:
+            result = append(result, editor.makeID3v2TextFrame("TORY", version, tag.OriginalDate.String()[0:4]))
+        }
+    }
+    mainComment := Comment{Language: editor.id3v2CommentLanguage(existingFrames), Text: tag.Comment}
+    if len(tag.Comment) != 0 {
+        result = append(result, editor.makeID3v2CommentFrame(version, mainComment))
+    }
+    for i, comment := range tag.Comments {
+        // description and language pair must be unique, the main comment has empty description
+        duplicate := len(tag.Comment) != 0 && mainComment.sameAs(comment)
+        for _, previous := range tag.Comments[:i] {
+            duplicate = duplicate || previous.sameAs(comment)
+        }
+        if !duplicate && len(comment.Text) != 0 {
+            result = append(result, editor.makeID3v2CommentFrame(version, comment))
+        }
+    }
+    if len(tag.Genre) != 0 {
+        result = append(result, editor.makeID3v2ValuesFrame("TCON", version, tag.Genre))
+    }
+    if len(tag.Composer) != 0 {
+        result = append(result, editor.makeID3v2ValuesFrame("TCOM", version, tag.Composer))
+    }
+    result = append(result, editor.makeID3v2PerformerFrames(tag.Performer, existingFrames, version) ...)
+    if tag.BPM != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TBPM", version, strconv.Itoa(tag.BPM)))
+    }
+    if len(tag.ISRC) != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TSRC", version, tag.ISRC))
+    }
+    if len(tag.Label) != 0 {
+        result = append(result, editor.makeID3v2TextFrame("TPUB", version, tag.Label))
+    }
+    if tag.Compilation {
+        result = append(result, editor.makeID3v2TextFrame("TCMP", version, "1"))
+    }
+    if len(tag.Lyrics) != 0 {
+        // the main lyrics frame keeps its language and description
+        language, description := "XXX", ""
+        if main := editor.id3v2MainLyrics(existingFrames); main != -1 {
+            lyrics, _ := editor.readID3v2Comment(existingFrames[main].data)
+            language, description = lyrics.Language, lyrics.Description
+        }
+        result = append(result, editor.makeID3v2LyricsFrame(version, language, description, tag.Lyrics))
+    }
+    if len(tag.SyncedLyrics) != 0 {
+        result = append(result, editor.makeID3v2SyncedLyricsFrame(version, editor.id3v2Language(existingFrames, "SYLT"), tag.SyncedLyrics))
+    }
+    if len(tag.Chapters) != 0 {
+        result = append(result, editor.makeID3v2ChapterFrames(completeChapters(tag.Chapters, 0), existingFrames, version) ...)
+    }
+    for _, key := range tag.customKeys() {
+        if len(tag.Custom[key]) != 0 {
+            result = append(result, editor.makeID3v2UserTextFrame(version, key, tag.Custom[key]))
+        }
+    }
+    for _, cover := range tag.Covers {
+        result = append(result, id3v2Frame{id: "APIC", data: editor.coverToData(cover)})
+    }
+
+    return result
+}
+
+// makeID3v2UserTextFrame makes TXXX frame, description and value are always null-separated,
+// several values are null-separated as well in ID3v2.4
+func (editor *Mp3TagEditor) makeID3v2UserTextFrame(version int, description, value string) id3v2Frame {
+    frame := editor.makeID3v2TextFrame("TXXX", version, description)
+    switch version {
+    case 4:
+        frame.data = append(append(frame.data, 0), strings.Join(SplitValues(value), "\x00") ...)
+    default:
+        frame.data = append(append(frame.data, 0, 0, 0xFF, 0xFE), utils.Utf8ToUtf16Le(value) ...)
+    }
+    return frame
+}
+
+// makeID3v2ChapterFrames makes CHAP frame for every chapter and top-level CTOC frame listing them,
+// element ids and sub-frames other than title are kept for chapters starting at the same time as existing ones,
+// ids of other CTOC frames are kept as they are written back as is
+func (editor *Mp3TagEditor) makeID3v2ChapterFrames(chapters []Chapter, existingFrames []id3v2Frame, version int) []id3v2Frame {
+    type element struct {
+        id string
+        subFrames []id3v2Frame
+    }
+    existingChapters := make(map[int]element)
+    toc := element{id: "toc"}
+    used := make(map[string]bool)
+    for _, frame := range existingFrames {
+        offset := editor.id3v2SubFramesOffset(frame)
+        if offset == -1 {
+            continue
+        }
+        id := string(frame.data[:bytes.IndexByte(frame.data, 0)])
+        subFrames, _ := editor.readID3v2Frames(frame.data[offset:], version, false)
+        var kept []id3v2Frame
+        for _, subFrame := range subFrames {
+            if frame.id != "CHAP" || subFrame.id != "TIT2" {
+                kept = append(kept, subFrame)
+            }
+        }
+        switch {
+        case frame.id == "CHAP":
+            existingChapters[utils.ReadInt32Be(frame.data[offset - 16 : offset - 12])] = element{id: id, subFrames: kept}
+        case editor.isID3v2TopLevelToc(frame):
+            toc = element{id: id, subFrames: kept}
+        default:
+            used[id] = true
+        }
+    }
+
+    elements := make([]element, len(chapters))
+    used[toc.id] = true
+    for i, chapter := range chapters {
+        if existing, ok := existingChapters[int(chapter.Start / time.Millisecond)]; ok && !used[existing.id] {
+            elements[i] = existing
+            used[existing.id] = true
+        }
+    }
+    next := 0
+    for i := range elements {
+        for ; len(elements[i].id) == 0; next++ {
+            if id := "chp" + strconv.Itoa(next); !used[id] {
+                elements[i].id = id
+                used[id] = true
+            }
+        }
+    }
+
+    result := make([]id3v2Frame, 0, len(chapters) + 1)
+    // top-level and ordered, entry count is a single byte
+    tocData := append([]byte(toc.id), 0, 0x03, 0)
+    for i, chapter := range chapters {
+        subFrames := elements[i].subFrames
+        if len(chapter.Title) != 0 {
+            subFrames = append([]id3v2Frame{editor.makeID3v2TextFrame("TIT2", version, chapter.Title)}, subFrames ...)
+        }
+
+        data := append([]byte(elements[i].id), 0)
+        times := make([]byte, 16)
+        utils.WriteInt32Be(int(chapter.Start / time.Millisecond), times[0:4])
+        utils.WriteInt32Be(int(chapter.End / time.Millisecond), times[4:8])
+        // byte offsets are not used
+        copy(times[8:16], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+        data = append(append(data, times ...), editor.serializeID3v2Frames(subFrames, version) ...)
+        result = append(result, id3v2Frame{id: "CHAP", data: data})
+
+        if i < 255 {
+            tocData = append(append(tocData, elements[i].id ...), 0)
+            tocData[len(toc.id) + 2]++
+        }
+    }
+    tocData = append(tocData, editor.serializeID3v2Frames(toc.subFrames, version) ...)
+
+    return append(result, id3v2Frame{id: "CTOC", data: tocData})
+}
+
+// isID3v2TopLevelToc checks if the frame is CTOC frame with top-level flag
+func (editor *Mp3TagEditor) isID3v2TopLevelToc(frame id3v2Frame) bool {
+    if frame.id != "CTOC" {
+        return false
+    }
+    pos := bytes.IndexByte(frame.data, 0)
+    return pos != -1 && len(frame.data) > pos + 1 && frame.data[pos + 1] & 0x02 != 0
+}
+
+// id3v2SubFramesOffset returns offset of sub-frames in CHAP or CTOC frame, or -1 for other or bad formatted frames
+func (editor *Mp3TagEditor) id3v2SubFramesOffset(frame id3v2Frame) int {
+    offset := bytes.IndexByte(frame.data, 0) + 1
+    if offset == 0 {
+        return -1
+    }
+
+    switch frame.id {
+    case "CHAP":
+        // start and end time, start and end offset
+        offset += 16
+    case "CTOC":
+        // flags and entry count followed by child element ids
+        if len(frame.data) < offset + 2 {
+            return -1
+        }
+        entries := int(frame.data[offset + 1])
+        offset += 2
+        for i := 0; i < entries; i++ {
+            pos := bytes.IndexByte(frame.data[offset:], 0)
+            if pos == -1 {
+                return -1
+            }
+            offset += pos + 1
+        }
+    default:
+        return -1
+    }
+
+    if offset > len(frame.data) {
+        return -1
+    }
+    return offset
+}
+
+// makeID3v2LyricsFrame makes USLT frame, its format is the same as of COMM frame
+func (editor *Mp3TagEditor) makeID3v2LyricsFrame(version int, language, description, lyrics string) id3v2Frame {
+    encoding := editor.id3v2TextEncoding(version)
+    data := append([]byte{encoding}, language ...)
+    data = append(data, editor.encodeID3v2TerminatedText(encoding, description) ...)
+    data = append(data, editor.encodeID3v2Text(encoding, lyrics) ...)
+    return id3v2Frame{id: "USLT", data: data}
+}
+
+// makeID3v2ValuesFrame makes text frame of a field with several values, they are null-separated in ID3v2.4
+// and stay joined in ID3v2.3, since its slash separator is a part of names like Pop/Funk or AC/DC
+func (editor *Mp3TagEditor) makeID3v2ValuesFrame(frameId string, version int, text string) id3v2Frame {
+    if version == 4 {
+        return editor.makeID3v2TextFrame(frameId, version, SplitValues(text) ...)
+    }
+    return editor.makeID3v2TextFrame(frameId, version, text)
+}
+
+// makeID3v2PerformerFrames makes TMCL frame of ID3v2.4 or IPLS frame of ID3v2.3 with 'performer' role
+// of every performer, the existing frame is kept if performers are the same, and other IPLS roles are kept anyway
+func (editor *Mp3TagEditor) makeID3v2PerformerFrames(performer string, existingFrames []id3v2Frame, version int) []id3v2Frame {
+    frameId := "TMCL"
+    if version != 4 {
+        frameId = "IPLS"
+    }
+
+    var pairs []string
+    for _, frame := range existingFrames {
+        if frame.id != frameId {
+            continue
+        }
+        if JoinValues(editor.readID3v2Performers(frameId, frame.data) ...) == performer {
+            return []id3v2Frame{frame}
+        }
+        if frameId == "IPLS" {
+            pairs = editor.readID3v2InvolvedPeople(frame.data)
+        }
+        break
+    }
+
+    for _, name := range SplitValues(performer) {
+        pairs = append(pairs, id3v2PerformerRole, name)
+    }
+    switch {
+    case len(pairs) == 0:
+        return nil
+    case version == 4:
+        return []id3v2Frame{editor.makeID3v2TextFrame(frameId, version, pairs ...)}
+    }
+    // ID3v2.3 IPLS values are null-separated unlike ones of text frames
+    return []id3v2Frame{{id: frameId, data: editor.encodeID3v2TextValues(pairs)}}
+}
+
+// makeID3v2CommentFrame makes COMM frame, unknown language is 'XXX'
+func (editor *Mp3TagEditor) makeID3v2CommentFrame(version int, comment Comment) id3v2Frame {
+    language := comment.Language
+    if len(language) != 3 {
+        language = "XXX"
+    }
+    encoding := editor.id3v2TextEncoding(version)
+    data := append([]byte{encoding}, language ...)
+    data = append(data, editor.encodeID3v2TerminatedText(encoding, comment.Description) ...)
+    data = append(data, editor.encodeID3v2Text(encoding, comment.Text) ...)
+    return id3v2Frame{id: "COMM", data: data}
+}
+
+// id3v2CommentLanguage returns language of existing comment without description
+func (editor *Mp3TagEditor) id3v2CommentLanguage(frames []id3v2Frame) string {
+    for _, frame := range frames {
+        if frame.id != "COMM" {
+            continue
+        }
+        if comment, ok := editor.readID3v2Comment(frame.data); ok && len(comment.Description) == 0 {
+            return comment.Language
+        }
+    }
+    return "XXX"
+}
+
+// makeID3v2SyncedLyricsFrame makes SYLT frame of lyrics content type with timestamps in milliseconds
+func (editor *Mp3TagEditor) makeID3v2SyncedLyricsFrame(version int, language string, lines []LyricsLine) id3v2Frame {
+    encoding := editor.id3v2TextEncoding(version)
+    data := append([]byte{encoding}, language ...)
+    data = append(data, 2, 1)
+    data = append(data, editor.encodeID3v2TerminatedText(encoding, "") ...)
+    for _, line := range lines {
+        data = append(data, editor.encodeID3v2TerminatedText(encoding, line.Text) ...)
+        timestamp := make([]byte, 4)
+        utils.WriteInt32Be(int(line.Time / time.Millisecond), timestamp)
+        data = append(data, timestamp ...)
+    }
+    return id3v2Frame{id: "SYLT", data: data}
+}
+
+// id3v2MainLyrics returns index of the main USLT frame, which is the 1st one with text, or -1 if there is no such frame
+func (editor *Mp3TagEditor) id3v2MainLyrics(frames []id3v2Frame) int {
+    for i, frame := range frames {
+        if frame.id == "USLT" && len(editor.readID3v2Lyrics(frame.data)) != 0 {
+            return i
+        }
+    }
+    return -1
+}
+
+// id3v2Language returns language of existing frame, unknown language is 'XXX'
+func (editor *Mp3TagEditor) id3v2Language(frames []id3v2Frame, frameId string) string {
+    for _, frame := range frames {
+        if frame.id == frameId && len(frame.data) >= 4 {
+            return string(frame.data[1:4])
+        }
+    }
+    return "XXX"
+}
+
+// id3v2TextEncoding is UTF-8 for ID3v2.4 and UTF-16 for ID3v2.3
+func (editor *Mp3TagEditor) id3v2TextEncoding(version int) byte {
+    if version == 4 {
+        return 3
+    }
+    return 1
+}
+
+// encodeID3v2Text encodes text as UTF-8 or UTF-16 with BOM
+func (editor *Mp3TagEditor) encodeID3v2Text(encoding byte, text string) []byte {
+    if encoding == 3 {
+        return []byte(text)
+    }
+    return append([]byte{0xFF, 0xFE}, utils.Utf8ToUtf16Le(text) ...)
+}
+
+func (editor *Mp3TagEditor) encodeID3v2TerminatedText(encoding byte, text string) []byte {
+    if encoding == 3 {
+        return append(editor.encodeID3v2Text(encoding, text), 0)
+    }
+    return append(editor.encodeID3v2Text(encoding, text), 0, 0)
+}
+
+// id3v2FrameKey identifies a frame among others, frames allowed to occur several times are distinguished
+// by owner or element id, language and description
+func (editor *Mp3TagEditor) id3v2FrameKey(frame id3v2Frame) string {
+    data := frame.data
+    switch frame.id {
+    case "TXXX":
+        if values := editor.splitID3v2TextValues(data); len(values) != 0 {
+            return frame.id + ":" + strings.ToUpper(values[0])
+        }
+    case "WXXX":
+        if len(data) >= 1 {
+            description, _ := editor.readID3v2TerminatedText(data[0], data[1:])
+            return frame.id + ":" + description
+        }
+    case "COMM", "USLT":
+        if len(data) >= 4 {
+            description, _ := editor.readID3v2TerminatedText(data[0], data[4:])
+            return frame.id + ":" + string(data[1:4]) + ":" + description
+        }
+    case "SYLT":
+        if len(data) >= 6 {
+            description, _ := editor.readID3v2TerminatedText(data[0], data[6:])
+            return frame.id + ":" + string(data[1:4]) + ":" + strconv.Itoa(int(data[5])) + ":" + description
+        }
+    case "PRIV", "UFID", "POPM", "CHAP", "CTOC":
+        // owner identifier, email or element id
+        owner, _ := editor.readID3v2TerminatedText(0, data)
+        return frame.id + ":" + owner
+    case "GEOB":
+        // MIME type and file name precede description
+        if len(data) >= 1 {
+            _, rest := editor.readID3v2TerminatedText(0, data[1:])
+            _, rest = editor.readID3v2TerminatedText(data[0], rest)
+            description, _ := editor.readID3v2TerminatedText(data[0], rest)
+            return frame.id + ":" + description
+        }
+    case "APIC":
+        // MIME type and picture type precede description
+        if len(data) >= 1 {
+            _, rest := editor.readID3v2TerminatedText(0, data[1:])
+            if len(rest) >= 1 {
+                description, _ := editor.readID3v2TerminatedText(data[0], rest[1:])
+                return frame.id + ":" + strconv.Itoa(int(rest[0])) + ":" + description
+            }
+        }
+    }
+    return frame.id
+}
+
+// makeID3v2TextFrame encodes text as UTF-16 for ID3v2.3 and as UTF-8 for ID3v2.4,
+// multiple values are null-separated in ID3v2.4 and slash-separated in ID3v2.3
+func (editor *Mp3TagEditor) makeID3v2TextFrame(frameId string, version int, values ...string) id3v2Frame {
+    var data []byte
+    switch version {
+    case 4:
+        text := strings.Join(values, "\x00")
+        data = make([]byte, 1 + len(text))
+        data[0] = 3 // text encoding
+        copy(data[1:], text)
+    default:
+        utf16Text := utils.Utf8ToUtf16Le(strings.Join(values, "/"))
+        data = make([]byte, 3 + len(utf16Text))
+        data[0] = 1 // text encoding
+        data[1] = 0xFF // UTF BOM
+        data[2] = 0xFE // UTF BOM
+        copy(data[3:], utf16Text)
+    }
+    return id3v2Frame{id: frameId, data: data}
+}
+
+// getUnsupportedID3v2Frames returns frames not covered by the tag, frames overridden by its custom fields are skipped
+func (editor *Mp3TagEditor) getUnsupportedID3v2Frames(frames []id3v2Frame, tag Tag) []id3v2Frame {
+    result := make([]id3v2Frame, 0, len(frames))
+    mainLyrics := editor.id3v2MainLyrics(frames)
+    for i, frame := range frames {
+        switch frame.id {
+        case "APIC", "COMM", "TALB", "TCON", "TIT2", "TPE1", "TRCK", "TYER", "TDAT", "TDRC", "TORY", "TDOR",
+             "TPE2", "TPOS", "TCOM", "TBPM", "TSRC", "TPUB", "TCMP", "CHAP", "TMCL", "IPLS":
+            break
+        case "USLT":
+            // lyrics in other languages or with other descriptions are kept, only the main lyrics are replaced
+            if i != mainLyrics && !tag.hasCustom(frame.id) {
+                result = append(result, frame)
+            }
+        case "CTOC":
+            // nested tables of contents are kept along with chapters, the top-level one is rewritten
+            if len(tag.Chapters) != 0 && !editor.isID3v2TopLevelToc(frame) {
+                result = append(result, frame)
+            }
+        case "SYLT":
+            // lyrics with timestamps in MPEG frames are kept unless replaced, other content types are kept as is
+            switch {
+            case len(frame.data) < 6 || tag.hasCustom(frame.id):
+                break
+            case frame.data[5] != 1 || (frame.data[4] != 2 && len(tag.SyncedLyrics) == 0):
+                result = append(result, frame)
+            }
+        case "TXXX":
+            if values := editor.splitID3v2TextValues(frame.data); len(values) == 0 || !tag.hasCustom(values[0]) {
+                result = append(result, frame)
+            }
+        default:
+            // custom field named after frame id removes the frame
+            if !tag.hasCustom(frame.id) {
+                result = append(result, frame)
+            }
+        }
+    }
+    return result
+}
+
+// reencodeID3v2LegacyText turns ISO-8859-1 text frame with non-ASCII characters into Unicode one,
+// so text of legacy charset is stored properly
+func (editor *Mp3TagEditor) reencodeID3v2LegacyText(frame id3v2Frame, version int) id3v2Frame {
+    if len(frame.data) == 0 || frame.data[0] != 0 || frame.id[0] != 'T' || utils.IsASCII(frame.data[1:]) {
+        return frame
+    }
+
+    values := editor.splitID3v2TextValues(frame.data)
+    var result id3v2Frame
+    switch {
+    case frame.id != "TXXX":
+        result = editor.makeID3v2TextFrame(frame.id, version, values ...)
+    case len(values) >= 2:
+        result = editor.makeID3v2UserTextFrame(version, values[0], strings.Join(values[1:], "/"))
+    default:
+        return frame
+    }
+    result.flags = frame.flags
+    return result
+}
+
+// convertID3v2Frames turns frames of one ID3v2 version into another one,
+// frames with different meaning or format in the versions are converted, others are kept as is
+func (editor *Mp3TagEditor) convertID3v2Frames(frames []id3v2Frame, from, to int) []id3v2Frame {
+    if from == to || len(frames) == 0 {
+        return frames
+    }
+
+    result := make([]id3v2Frame, 0, len(frames))
+    var year, dayMonth, hourMinute string
+
+    for _, frame := range frames {
+        flags, ok := editor.convertID3v2FrameFlags(frame.flags, from, to)
+        if !ok {
+            utils.Log(utils.WARNING, "ID3v2 frame '%v' with format flags %x cannot be converted from version 2.%v to 2.%v", frame.id, frame.flags[1], from, to)
+            continue
+        }
+        frame.flags = flags
+
+        if to == 3 {
+            frame = editor.reencodeID3v2Utf8Frame(frame)
+        }
+
+        switch {
+        case to == 4 && frame.id == "TYER":
+            year = editor.readID3v2Text(frame.data)
+        case to == 4 && frame.id == "TDAT":
+            dayMonth = editor.readID3v2Text(frame.data)
+        case to == 4 && frame.id == "TIME":
+            hourMinute = editor.readID3v2Text(frame.data)
+        case to == 4 && frame.id == "TORY":
+            result = append(result, editor.makeID3v2TextFrame("TDOR", to, editor.readID3v2Text(frame.data)))
+        case to == 4 && frame.id == "IPLS":
+            // performers go to TMCL frame
+            if pairs := editor.readID3v2InvolvedPeople(frame.data); len(pairs) != 0 {
+                tipl := editor.makeID3v2TextFrame("TIPL", to, pairs ...)
+                tipl.flags = frame.flags
+                result = append(result, tipl)
+            }
+        case to == 3 && frame.id == "TDRC":
+            result = append(result, editor.splitID3v2RecordingTime(editor.readID3v2Text(frame.data)) ...)
+        case to == 3 && frame.id == "TDOR":
+            if text := editor.readID3v2Text(frame.data); len(text) >= 4 {
+                result = append(result, editor.makeID3v2TextFrame("TORY", to, text[:4]))
+            }
+        case to == 3 && frame.id == "TIPL":
+            frame.id = "IPLS"
+            result = append(result, frame)
+        case frame.id == "CHAP" || frame.id == "CTOC":
+            // sub-frames headers differ in the versions
+            if offset := editor.id3v2SubFramesOffset(frame); offset != -1 {
+                subFrames, err := editor.readID3v2Frames(frame.data[offset:], from, false)
+                if err == nil {
+                    subFrames = editor.convertID3v2Frames(subFrames, from, to)
+                    frame.data = append(append([]byte{}, frame.data[:offset] ...), editor.serializeID3v2Frames(subFrames, to) ...)
+                }
+            }
+            result = append(result, frame)
+        default:
+            result = append(result, frame)
+        }
+    }
+
+    // TYER, TDAT and TIME are merged into TDRC (yyyy-MM-ddTHH:mm)
+    if len(year) != 0 {
+        date := year
+        if len(dayMonth) == 4 {
+            date += "-" + dayMonth[2:4] + "-" + dayMonth[0:2]
+            if len(hourMinute) == 4 {
+                date += "T" + hourMinute[0:2] + ":" + hourMinute[2:4]
+            }
+        }
+        result = append(result, editor.makeID3v2TextFrame("TDRC", to, date))
+    }
+
+    return result
+}
+
+// encodeID3v2TextValues encodes null-separated values as UTF-16 with BOM
+func (editor *Mp3TagEditor) encodeID3v2TextValues(values []string) []byte {
+    result := []byte{1}
+    for i, value := range values {
+        if i > 0 {
+            result = append(result, 0, 0)
+        }
+        result = append(result, 0xFF, 0xFE)
+        result = append(result, utils.Utf8ToUtf16Le(value) ...)
+    }
+    return result
+}
+
+// id3v2EncodedFrameLayouts describe fields of frames holding text of the encoding given by the 1st byte:
+// a digit is a field of fixed size, 'l' is null-terminated ISO-8859-1 text, 't' is null-terminated text
+// of the encoding, 'T' is text of the encoding up to the end, 's' is text and timestamp pairs up to the end
+// and 'b' is binary data up to the end
+var id3v2EncodedFrameLayouts = map[string]string{
+    "COMM": "3tT", "USLT": "3tT", "SYLT": "5ts", "USER": "3T", "WXXX": "tb",
+    "APIC": "l1tb", "GEOB": "lttb", "OWNE": "l8T", "COMR": "l8l1ttlb",
+}
+
+// reencodeID3v2Utf8Frame turns UTF-8 text of the frame into UTF-16, since ID3v2.3 has no UTF-8 encoding,
+// frames of unknown layout and malformed frames are kept as is
+func (editor *Mp3TagEditor) reencodeID3v2Utf8Frame(frame id3v2Frame) id3v2Frame {
+    if len(frame.data) == 0 || frame.data[0] != 3 {
+        return frame
+    }
+    if frame.id[0] == 'T' || frame.id == "IPLS" {
+        frame.data = editor.encodeID3v2TextValues(editor.splitID3v2TextValues(frame.data))
+        return frame
+    }
+    layout, ok := id3v2EncodedFrameLayouts[frame.id]
+    if !ok {
+        return frame
+    }
+
+    result := []byte{1}
+    data := frame.data[1:]
+    for _, field := range layout {
+        switch field {
+        case 'l':
+            end := bytes.IndexByte(data, 0)
+            if end == -1 {
+                return frame
+            }
+            result = append(result, data[:end + 1] ...)
+            data = data[end + 1:]
+        case 't':
+            var text string
+            text, data = editor.readID3v2TerminatedText(3, data)
+            result = append(result, editor.encodeID3v2TerminatedText(1, text) ...)
+        case 'T':
+            result = append(result, editor.encodeID3v2Text(1, editor.decodeText(3, data)) ...)
+            data = nil
+        case 's':
+            for len(data) > 0 {
+                var text string
+                text, data = editor.readID3v2TerminatedText(3, data)
+                if len(data) < 4 {
+                    return frame
+                }
+                result = append(append(result, editor.encodeID3v2TerminatedText(1, text) ...), data[:4] ...)
+                data = data[4:]
+            }
+        case 'b':
+            result = append(result, data ...)
+            data = nil
+        default:
+            size := int(field - '0')
+            if len(data) < size {
+                return frame
+            }
+            result = append(result, data[:size] ...)
+            data = data[size:]
+        }
+    }
+    frame.data = result
+    return frame
+}
+
+// readID3v2InvolvedPeople returns role and name pairs of IPLS frame except performers
+func (editor *Mp3TagEditor) readID3v2InvolvedPeople(data []byte) []string {
+    var result []string
+    values := editor.splitID3v2TextValues(data)
+    for i := 0; i + 1 < len(values); i += 2 {
+        if !strings.EqualFold(values[i], id3v2PerformerRole) {
+            result = append(result, values[i], values[i + 1])
+        }
+    }
+    return result
+}
+
+// splitID3v2RecordingTime turns ID3v2.4 timestamp (yyyy-MM-ddTHH:mm:ss) into ID3v2.3 TYER, TDAT and TIME frames
+func (editor *Mp3TagEditor) splitID3v2RecordingTime(timestamp string) []id3v2Frame {
+    result := make([]id3v2Frame, 0, 3)
+    if len(timestamp) >= 4 {
+        result = append(result, editor.makeID3v2TextFrame("TYER", 3, timestamp[0:4]))
+    }
+    if len(timestamp) >= 10 {
+        result = append(result, editor.makeID3v2TextFrame("TDAT", 3, timestamp[8:10] + timestamp[5:7]))
+    }
+    if len(timestamp) >= 16 {
+        result = append(result, editor.makeID3v2TextFrame("TIME", 3, timestamp[11:13] + timestamp[14:16]))
+    }
+    return result
+}
+
+// convertID3v2FrameFlags moves status flags to their places in another version,
+// frames with format flags (compression, encryption, etc.) cannot be converted
+func (editor *Mp3TagEditor) convertID3v2FrameFlags(flags [2]byte, from, to int) ([2]byte, bool) {
+    if from == to {
+        return flags, true
+    }
+    if flags[1] != 0 {
+        return flags, false
+    }
+
+    switch {
+    case from == 3 && to == 4:
+        return [2]byte{(flags[0] >> 1) & 0x70, 0}, true
+    case from == 4 && to == 3:
+        return [2]byte{(flags[0] << 1) & 0xE0, 0}, true
+    }
+    return [2]byte{}, true
+}
+
+func (editor *Mp3TagEditor) serializeID3v2Frames(frames []id3v2Frame, version int) []byte {
+    size := 0
+    for _, frame := range frames {
+        size += id3v2FrameHeaderSize + len(frame.data)
+    }
+
+    result := make([]byte, size)
+    offset := 0
+    for _, frame := range frames {
+        copy(result[offset : offset + id3v2FrameIdSize], frame.id)
+        switch version {
+        case 4:
+            editor.writeSyncInt32Be(len(frame.data), result[offset + 4 : offset + 8])
+        default:
+            utils.WriteInt32Be(len(frame.data), result[offset + 4 : offset + 8])
+        }
+        result[offset + 8] = frame.flags[0]
+        result[offset + 9] = frame.flags[1]
+        copy(result[offset + id3v2FrameHeaderSize:], frame.data)
+        offset += id3v2FrameHeaderSize + len(frame.data)
+    }
+
+    return result
+}
+
+func (editor *Mp3TagEditor) makeID3v2TagHeader(size, version int) []byte {
+    header := make([]byte, id3v2HeaderSize)
+    header[0] = 0x49 // I
+    header[1] = 0x44 // D
+    header[2] = 0x33 // 3
+    header[3] = byte(version)
+    header[4] = 0x00
+    header[5] = 0x00
+    editor.writeSyncInt32Be(size, header[6:id3v2HeaderSize])
+    return header
+}
+
+var id3v22FrameIds = map[string]string {
+    "BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC", "ETC": "ETCO", "EQU": "EQUA",
+    "GEO": "GEOB", "IPL": "IPLS", "LNK": "LINK", "MCI": "MCDI", "MLL": "MLLT", "PIC": "APIC",
+    "POP": "POPM", "REV": "RVRB", "RVA": "RVAD", "SLT": "SYLT", "STC": "SYTC", "TAL": "TALB",
+    "TBP": "TBPM", "TCM": "TCOM", "TCO": "TCON", "TCP": "TCMP", "TCR": "TCOP", "TDA": "TDAT",
+    "TDY": "TDLY", "TEN": "TENC", "TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN",
+    "TLE": "TLEN", "TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY",
+    "TOT": "TOAL", "TP1": "TPE1", "TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4", "TPA": "TPOS",
+    "TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TRK": "TRCK", "TSI": "TSIZ", "TSS": "TSSE",
+    "TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3", "TXT": "TEXT", "TXX": "TXXX", "TYE": "TYER",
+    "UFI": "UFID", "ULT": "USLT", "WAF": "WOAF", "WAR": "WOAR", "WAS": "WOAS", "WCM": "WCOM",
+    "WCP": "WCOP", "WPB": "WPUB", "WXX": "WXXX",
+}
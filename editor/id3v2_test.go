@@ -0,0 +1,160 @@
+package editor
+
+import (
+    "bytes"
+    "compress/zlib"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestConvertID3v2Frames(t *testing.T) {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    comment := Comment{Language: "eng", Description: "описание", Text: "текст"}
+    frames := editor.convertID3v2Frames([]id3v2Frame{
+        editor.makeID3v2CommentFrame(4, comment),
+        {id: "TXXX", data: []byte("\x03\x00value")},
+        {id: "WXXX", data: []byte("\x03ссылка\x00http://example.com")},
+    }, 4, 3)
+
+    if len(frames) != 3 {
+        t.Fatalf("%v frames, expected 3", len(frames))
+    }
+    for _, frame := range frames {
+        if frame.data[0] != 1 {
+            t.Errorf("frame '%v' has encoding %v, expected UTF-16", frame.id, frame.data[0])
+        }
+    }
+    if result, _ := editor.readID3v2Comment(frames[0].data); result != comment {
+        t.Errorf("wrong comment %v", result)
+    }
+    if values := editor.splitID3v2TextValues(frames[1].data); !reflect.DeepEqual(values, []string{"", "value"}) {
+        t.Errorf("wrong user text values %q", values)
+    }
+    if description, url := editor.readID3v2TerminatedText(1, frames[2].data[1:]); description != "ссылка" || string(url) != "http://example.com" {
+        t.Errorf("wrong user link '%v' '%v'", description, string(url))
+    }
+}
+
+func TestConvertID3v2InvolvedPeople(t *testing.T) {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    ipls := id3v2Frame{id: "IPLS", data: editor.encodeID3v2TextValues([]string{"performer", "Singer", "producer", "Producer"})}
+
+    // performers are written to TMCL frame of ID3v2.4
+    frames := editor.convertID3v2Frames([]id3v2Frame{ipls}, 3, 4)
+    if len(frames) != 1 || frames[0].id != "TIPL" {
+        t.Fatalf("wrong frames %v", frames)
+    }
+    if values := editor.readID3v2TextValues(frames[0].data); !reflect.DeepEqual(values, []string{"producer", "Producer"}) {
+        t.Errorf("wrong TIPL values %q", values)
+    }
+
+    frames = editor.makeID3v2PerformerFrames("Singer", frames, 4)
+    if len(frames) != 1 || frames[0].id != "TMCL" {
+        t.Errorf("wrong performer frames %v", frames)
+    }
+}
+
+func TestReadID3v22Frames(t *testing.T) {
+    title := []byte("TT2\x00\x00\x06\x00Title")
+    picture := []byte("PIC\x00\x00\x08\x00PNG\x03\x00\x01\x02")
+    tests := []struct {
+        name string
+        data []byte
+        frames []id3v2Frame
+        fails bool
+    }{
+        {"frames and padding", append(append(append([]byte{}, title ...), picture ...), 0, 0, 0, 0), []id3v2Frame{
+            {id: "TIT2", data: []byte("\x00Title")},
+            {id: "APIC", data: []byte("\x00image/png\x00\x03\x00\x01\x02")},
+        }, false},
+        {"unknown frame", []byte("XYZ\x00\x00\x01\x00"), []id3v2Frame{}, false},
+        {"truncated frame", title[:len(title) - 1], nil, true},
+        {"truncated header", append(append([]byte{}, title ...), "TP1\x00"...), nil, true},
+    }
+
+    editor := &Mp3TagEditor{}
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            frames, err := editor.readID3v22Frames(test.data)
+            if (err != nil) != test.fails {
+                t.Fatalf("error: %v", err)
+            }
+            if !test.fails && !reflect.DeepEqual(frames, test.frames) {
+                t.Errorf("wrong frames %q", frames)
+            }
+        })
+    }
+}
+
+func TestDecodeID3v2Frame(t *testing.T) {
+    var compressed bytes.Buffer
+    writer := zlib.NewWriter(&compressed)
+    writer.Write([]byte("\x03Title"))
+    writer.Close()
+
+    tests := []struct {
+        name string
+        version int
+        flags byte
+        data []byte
+        fails bool
+    }{
+        {"no flags", 4, 0, []byte("\x03Title"), false},
+        {"v2.3 compression", 3, 0x80, append([]byte{0, 0, 0, 6}, compressed.Bytes() ...), false},
+        {"v2.3 group", 3, 0x20, []byte("\x01\x03Title"), false},
+        {"v2.3 encryption", 3, 0x40, []byte("\x01\x03Title"), true},
+        {"v2.4 compression", 4, 0x09, append([]byte{0, 0, 0, 6}, compressed.Bytes() ...), false},
+        {"v2.4 compression without length", 4, 0x08, compressed.Bytes(), true},
+        {"v2.4 unsynchronisation", 4, 0x02, []byte("\x03Title"), false},
+        {"v2.4 group and length", 4, 0x41, []byte("\x01\x00\x00\x00\x06\x03Title"), false},
+        {"too short", 4, 0x41, []byte("\x01\x00"), true},
+    }
+
+    editor := &Mp3TagEditor{}
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            frame, err := editor.decodeID3v2Frame(id3v2Frame{id: "TIT2", flags: [2]byte{0x60, test.flags}, data: test.data}, test.version, false)
+            if (err != nil) != test.fails {
+                t.Fatalf("error: %v", err)
+            }
+            if test.fails {
+                return
+            }
+            if string(frame.data) != "\x03Title" || frame.flags != [2]byte{0x60, 0} {
+                t.Errorf("wrong frame %q, flags %x", frame.data, frame.flags)
+            }
+        })
+    }
+}
+
+func TestUnsupportedID3v2Lyrics(t *testing.T) {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    mpegTimeLyrics := id3v2Frame{id: "SYLT", data: []byte("\x00eng\x01\x01\x00Line\x00\x00\x00\x00\x10")}
+    transcription := id3v2Frame{id: "SYLT", data: []byte("\x00eng\x02\x02\x00Text\x00\x00\x00\x00\x10")}
+    frames := []id3v2Frame{
+        editor.makeID3v2LyricsFrame(3, "eng", "", "Main lyrics"),
+        editor.makeID3v2LyricsFrame(3, "deu", "", "Other lyrics"),
+        mpegTimeLyrics,
+        transcription,
+        editor.makeID3v2SyncedLyricsFrame(3, "eng", []LyricsLine{{time.Second, "Line"}}),
+    }
+    tests := []struct {
+        name string
+        tag Tag
+        expected []id3v2Frame
+    }{
+        {"no lyrics", Tag{}, []id3v2Frame{frames[1], mpegTimeLyrics, transcription}},
+        {"lyrics", Tag{Lyrics: "New lyrics", SyncedLyrics: []LyricsLine{{0, "New"}}}, []id3v2Frame{frames[1], transcription}},
+        {"removed frames", Tag{Custom: map[string]string{"USLT": "", "SYLT": ""}}, nil},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            result := editor.getUnsupportedID3v2Frames(frames, test.tag)
+            if len(result) != len(test.expected) || len(result) != 0 && !reflect.DeepEqual(result, test.expected) {
+                t.Errorf("wrong frames %q", result)
+            }
+        })
+    }
+}
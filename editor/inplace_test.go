@@ -0,0 +1,142 @@
+package editor
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// testAudio is the payload of test files, it must stay at the end of the files after every update
+var testAudio = []byte("\xff\xf8AUDIO DATA")
+
+// makeTestMp3 makes ID3v2 tag without padding followed by audio
+func makeTestMp3() []byte {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    return append(editor.makeNewID3v2TagData(nil, nil, Tag{Title: "original"}, 0), testAudio ...)
+}
+
+// makeTestFlac makes STREAMINFO as the only metadata block followed by audio
+func makeTestFlac() []byte {
+    streamInfo := make([]byte, 34)
+    // 44100 Hz, stereo, 16 bits per sample
+    copy(streamInfo[10:14], []byte{0x0A, 0xC4, 0x42, 0xF0})
+    data := append([]byte("fLaC"), 0x80, 0, 0, byte(len(streamInfo)))
+    return append(append(data, streamInfo ...), testAudio ...)
+}
+
+// makeTestOgg makes Vorbis stream of identification page, page of comment and setup headers and audio page
+func makeTestOgg() []byte {
+    editor := &OggTagEditor{options: DefaultOptions()}
+    idPage, _ := editor.packTagDataIntoFrames(1, 0, append([]byte("\x01vorbis"), make([]byte, 23) ...))
+    commentPage := makeTestOggPage(editor, 1, 1,
+        []byte("\x03vorbis\x03\x00\x00\x00xyz\x01\x00\x00\x00\x0e\x00\x00\x00TITLE=original\x01"),
+        []byte("\x05vorbisSETUP"))
+    audioPage, _ := editor.packTagDataIntoFrames(1, 2, testAudio)
+    return append(append(idPage, commentPage ...), audioPage ...)
+}
+
+// makeTestOggPage packs packets smaller than 255 bytes into a single page
+func makeTestOggPage(editor *OggTagEditor, bitstream, sequence int, packets ...[]byte) []byte {
+    page := make([]byte, 27)
+    copy(page, "OggS")
+    page[14] = byte(bitstream)
+    page[18] = byte(sequence)
+    page[26] = byte(len(packets))
+    for _, packet := range packets {
+        page = append(page, byte(len(packet)))
+    }
+    for _, packet := range packets {
+        page = append(page, packet ...)
+    }
+    crc := editor.crc(page)
+    copy(page[22:26], []byte{byte(crc), byte(crc >> 8), byte(crc >> 16), byte(crc >> 24)})
+    return page
+}
+
+func TestInPlaceUpdate(t *testing.T) {
+    files := []struct {
+        extension string
+        editorType EditorType
+        makeFile func() []byte
+    }{
+        {"mp3", Mp3, makeTestMp3},
+        {"flac", Flac, makeTestFlac},
+        {"ogg", Ogg, makeTestOgg},
+    }
+    updates := []struct {
+        name string
+        inPlace bool
+        tag Tag
+        overwritten bool
+    }{
+        {"fits padding", true, Tag{Title: "new title", Artist: "Artist", Album: "Album", Track: 2}, true},
+        {"exceeds padding", true, Tag{Title: strings.Repeat("long title", 200)}, false},
+        {"in-place disabled", false, Tag{Title: "new title", Artist: "Artist"}, false},
+    }
+
+    for _, file := range files {
+        for _, update := range updates {
+            t.Run(file.extension + "/" + update.name, func(t *testing.T) {
+                path := filepath.Join(t.TempDir(), "test." + file.extension)
+                if err := ioutil.WriteFile(path, file.makeFile(), 0644); err != nil {
+                    t.Fatal(err)
+                }
+                // the file is rewritten with padding first
+                writeTestTag(t, NewEditor(file.editorType), path, Tag{Title: "first"})
+                options := DefaultOptions()
+                options.InPlace = update.inPlace
+                editor := NewEditor(file.editorType, options)
+
+                before := statTestFile(t, path)
+                writeTestTag(t, editor, path, update.tag)
+                after := statTestFile(t, path)
+
+                overwritten := os.SameFile(before, after) && before.Size() == after.Size()
+                if overwritten != update.overwritten {
+                    t.Errorf("file overwritten in place: %v, expected: %v", overwritten, update.overwritten)
+                }
+                checkTestTag(t, editor, path, update.tag)
+                checkTestAudio(t, path)
+            })
+        }
+    }
+}
+
+func writeTestTag(t *testing.T, editor Editor, path string, tag Tag) {
+    if err := editor.WriteTag(path, path, tag); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func statTestFile(t *testing.T, path string) os.FileInfo {
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return info
+}
+
+// checkTestTag checks fields of the tag read from the file
+func checkTestTag(t *testing.T, editor Editor, path string, expected Tag) {
+    tag, err := editor.ReadTag(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tag.Title != expected.Title || tag.Artist != expected.Artist || tag.Album != expected.Album || tag.Track != expected.Track {
+        t.Errorf("wrong tag:\n%v", tag)
+    }
+}
+
+// checkTestAudio checks that audio payload is at the end of the file
+func checkTestAudio(t *testing.T, path string) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.HasSuffix(data, testAudio) {
+        t.Error("audio data is damaged")
+    }
+}
@@ -0,0 +1,97 @@
+package editor
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// LyricsLine is a line of time-synchronised lyrics
+type LyricsLine struct {
+    Time time.Duration
+    Text string
+}
+
+var (
+    lrcTimestamp = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+    lrcOffset = regexp.MustCompile(`^\[offset:\s*([+-]?\d+)\s*\]`)
+)
+
+// ParseLrc parses LRC text, a line may have several timestamps, lines without timestamps are skipped,
+// so nil is returned for plain text
+func ParseLrc(text string) []LyricsLine {
+    var result []LyricsLine
+    offset := time.Duration(0)
+
+    for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+        line = strings.TrimSpace(line)
+        if match := lrcOffset.FindStringSubmatch(line); match != nil {
+            milliseconds, _ := strconv.Atoi(match[1])
+            offset = time.Duration(milliseconds) * time.Millisecond
+            continue
+        }
+
+        var times []time.Duration
+        for match := lrcTimestamp.FindStringSubmatch(line); match != nil; match = lrcTimestamp.FindStringSubmatch(line) {
+            minutes, _ := strconv.Atoi(match[1])
+            seconds, _ := strconv.Atoi(match[2])
+            lineTime := time.Duration(minutes) * time.Minute + time.Duration(seconds) * time.Second
+            if len(match[3]) != 0 {
+                // hundredths of second usually, milliseconds sometimes
+                fraction, _ := strconv.Atoi(match[3])
+                for i := len(match[3]); i < 3; i++ {
+                    fraction *= 10
+                }
+                lineTime += time.Duration(fraction) * time.Millisecond
+            }
+            times = append(times, lineTime)
+            line = line[len(match[0]):]
+        }
+
+        for _, lineTime := range times {
+            result = append(result, LyricsLine{Time: lineTime, Text: line})
+        }
+    }
+
+    // positive offset makes lyrics appear sooner
+    for i := range result {
+        result[i].Time -= offset
+        if result[i].Time < 0 {
+            result[i].Time = 0
+        }
+    }
+    sort.SliceStable(result, func(i, j int) bool {
+        return result[i].Time < result[j].Time
+    })
+    return result
+}
+
+// setLyrics sets lyrics of formats with a single lyrics field holding either LRC or plain text
+func setLyrics(tag *Tag, text string) {
+    if lines := ParseLrc(text); len(lines) != 0 {
+        tag.SyncedLyrics = lines
+    } else {
+        tag.Lyrics = text
+    }
+}
+
+// lyricsText returns lyrics for formats with a single lyrics field, plain text is preferred to LRC
+func (tag Tag) lyricsText() string {
+    if len(tag.Lyrics) != 0 {
+        return tag.Lyrics
+    }
+    return FormatLrc(tag.SyncedLyrics)
+}
+
+// FormatLrc makes LRC text with timestamps in hundredths of second
+func FormatLrc(lines []LyricsLine) string {
+    var builder strings.Builder
+    for _, line := range lines {
+        hundredths := int64(line.Time / (10 * time.Millisecond))
+        fmt.Fprintf(&builder, "[%02d:%02d.%02d]%v\n", hundredths / 6000, hundredths / 100 % 60, hundredths % 100, line.Text)
+    }
+    return builder.String()
+}
@@ -0,0 +1,53 @@
+package editor
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseLrc(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+        expected []LyricsLine
+    }{
+        {"plain text", "First line\nSecond line", nil},
+        {"hundredths", "[00:01.50]First\r\n[01:02.05]Second", []LyricsLine{
+            {1500 * time.Millisecond, "First"},
+            {time.Minute + 2050 * time.Millisecond, "Second"},
+        }},
+        {"milliseconds and no fraction", "[00:01.500]First\n[00:03]Second", []LyricsLine{
+            {1500 * time.Millisecond, "First"},
+            {3 * time.Second, "Second"},
+        }},
+        {"several timestamps", "[00:05.00][00:01.00]Chorus\n[00:03.00]Verse", []LyricsLine{
+            {time.Second, "Chorus"},
+            {3 * time.Second, "Verse"},
+            {5 * time.Second, "Chorus"},
+        }},
+        {"offset and tags", "[ar:Artist]\n[offset:+1500]\n[00:01.00]First\n[00:03.00]Second", []LyricsLine{
+            {0, "First"},
+            {1500 * time.Millisecond, "Second"},
+        }},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if lines := ParseLrc(test.text); !reflect.DeepEqual(lines, test.expected) {
+                t.Errorf("wrong lines %v", lines)
+            }
+        })
+    }
+}
+
+func TestFormatLrc(t *testing.T) {
+    lines := []LyricsLine{{1500 * time.Millisecond, "First"}, {61 * time.Minute + 2055 * time.Millisecond, "Second"}}
+    text := FormatLrc(lines)
+    if text != "[00:01.50]First\n[61:02.05]Second\n" {
+        t.Errorf("wrong text %q", text)
+    }
+    if parsed := ParseLrc(text); !reflect.DeepEqual(parsed, []LyricsLine{lines[0], {61 * time.Minute + 2050 * time.Millisecond, "Second"}}) {
+        t.Errorf("wrong parsed lines %v", parsed)
+    }
+}
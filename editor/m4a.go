@@ -0,0 +1,645 @@
+package editor
+
+import (
+    "errors"
+    "io"
+    "strings"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+const (
+    m4aAtomHeaderSize int = 8
+    m4aLargeAtomHeaderSize int = 16
+    m4aFullAtomHeaderSize int = 4
+    m4aDataTypeImplicit int = 0
+    m4aDataTypeUtf8 int = 1
+    m4aDataTypeInteger int = 21
+    m4aFreeformMean string = "com.apple.iTunes"
+    m4aDataTypeJpeg int = 13
+    m4aDataTypePng int = 14
+    m4aDataTypeBmp int = 27
+)
+
+type M4aTagEditor struct {
+    options Options
+}
+
+type m4aAtom struct {
+    name string
+    position int
+    headerSize int
+    size int
+    // header and payload, nil if the atom is not loaded from file
+    data []byte
+}
+
+func (atom m4aAtom) payload() []byte {
+    return atom.data[atom.headerSize:]
+}
+
+func (editor *M4aTagEditor) ReadTag(path string) (Tag, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Tag{}, err
+    }
+    defer file.Close()
+
+    moov, err := editor.findMoov(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
+
+    var tag Tag
+    ilst := editor.findAtom(moov.payload(), "udta", "meta", "ilst")
+    if ilst == nil {
+        return tag, nil
+    }
+
+    for _, item := range editor.readAtoms(ilst.payload()) {
+        editor.parseItem(&tag, item)
+    }
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+
+    return tag, nil
+}
+
+func (editor *M4aTagEditor) WriteTag(src, dst string, tag Tag) error {
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+    return editor.writeItems(src, dst, func(ilst *m4aAtom) []byte {
+        if ilst == nil {
+            return editor.serializeTag(tag)
+        }
+        unsupportedItems, remainingTag := editor.getUnsupportedItems(ilst.payload(), tag)
+        return append(editor.serializeTag(remainingTag), unsupportedItems ...)
+    })
+}
+
+func (editor *M4aTagEditor) RemoveTag(src, dst string) error {
+    return editor.writeItems(src, dst, func(ilst *m4aAtom) []byte {
+        return nil
+    })
+}
+
+// writeItems replaces items list with the one made from the existing list, nil if there is no list
+func (editor *M4aTagEditor) writeItems(src, dst string, makeItems func(ilst *m4aAtom) []byte) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    moov, err := editor.findMoov(file, size)
+    if err != nil {
+        return err
+    }
+
+    newIlst := editor.makeAtom("ilst", makeItems(editor.findAtom(moov.payload(), "udta", "meta", "ilst")))
+
+    // overwrite only moov atom if it keeps its size with free atom after the items, so chunk offsets are not changed
+    if editor.options.InPlace && isSameFile(file, dst) {
+        padding := len(moov.data) - len(editor.makeNewMoov(moov, newIlst, 0))
+        if padding == 0 || padding >= m4aAtomHeaderSize {
+            return writeAt(dst, fileRegion{int64(moov.position), editor.makeNewMoov(moov, newIlst, padding)})
+        }
+    }
+
+    padding := 0
+    if editor.options.Padding > 0 {
+        padding = m4aAtomHeaderSize + editor.options.Padding
+    }
+    newMoov := editor.makeNewMoov(moov, newIlst, padding)
+
+    delta := len(newMoov) - len(moov.data)
+    if err = editor.fixChunkOffsets(newMoov[m4aAtomHeaderSize:], moov.position + len(moov.data), delta); err != nil {
+        return err
+    }
+
+    builder := newFileBuilder(file)
+    builder.appendRange(0, int64(moov.position))
+    builder.appendData(newMoov)
+    builder.appendRange(int64(moov.position + moov.size), size - int64(moov.position + moov.size))
+    return builder.save(dst)
+}
+
+// findMoov walks top level atoms of file and loads moov atom, media data is not read
+func (editor *M4aTagEditor) findMoov(file io.ReaderAt, fileSize int64) (m4aAtom, error) {
+    position := int64(0)
+    for fileSize - position >= int64(m4aAtomHeaderSize) {
+        header, err := readAt(file, position, m4aAtomHeaderSize)
+        if err != nil {
+            return m4aAtom{}, err
+        }
+
+        atom := m4aAtom{name: string(header[4:8]), position: int(position), headerSize: m4aAtomHeaderSize}
+        if position == 0 && atom.name != "ftyp" {
+            return m4aAtom{}, errors.New("file is not an MP4 container")
+        }
+
+        size := int64(utils.ReadInt32Be(header[0:4]))
+        switch size {
+        case 0:
+            size = fileSize - position
+        case 1:
+            largeSize, err := readAt(file, position + int64(m4aAtomHeaderSize), 8)
+            if err != nil {
+                return m4aAtom{}, err
+            }
+            atom.headerSize = m4aLargeAtomHeaderSize
+            size = int64(utils.ReadInt32Be(largeSize[0:4])) * 0x100000000 + int64(utils.ReadInt32Be(largeSize[4:8]))
+        }
+        if size < int64(atom.headerSize) || size > fileSize - position {
+            break
+        }
+        atom.size = int(size)
+
+        if atom.name == "moov" {
+            if atom.headerSize != m4aAtomHeaderSize {
+                return m4aAtom{}, errors.New("64-bit moov atom is not supported")
+            }
+            atom.data, err = readAt(file, position, atom.size)
+            return atom, err
+        }
+        position += size
+    }
+
+    if position == 0 {
+        return m4aAtom{}, errors.New("file is not an MP4 container")
+    }
+    return m4aAtom{}, errors.New("no moov atom found")
+}
+
+func (editor *M4aTagEditor) readAtoms(data []byte) []m4aAtom {
+    result := make([]m4aAtom, 0, 8)
+    position := 0
+
+    for len(data) - position >= m4aAtomHeaderSize {
+        headerSize := m4aAtomHeaderSize
+        size := utils.ReadInt32Be(data[position : position + 4])
+
+        switch size {
+        case 0:
+            size = len(data) - position
+        case 1:
+            if len(data) - position < m4aLargeAtomHeaderSize {
+                return result
+            }
+            headerSize = m4aLargeAtomHeaderSize
+            size = utils.ReadInt32Be(data[position + 8 : position + 12]) * 0x100000000 + utils.ReadInt32Be(data[position + 12 : position + 16])
+        }
+
+        if size < headerSize || size > len(data) - position {
+            break
+        }
+
+        result = append(result, m4aAtom{
+            name: string(data[position + 4 : position + 8]),
+            position: position,
+            headerSize: headerSize,
+            size: size,
+            data: data[position : position + size],
+        })
+        position += size
+    }
+
+    return result
+}
+
+func (editor *M4aTagEditor) findAtom(data []byte, path ...string) *m4aAtom {
+    for _, atom := range editor.readAtoms(data) {
+        if atom.name != path[0] {
+            continue
+        }
+        if len(path) == 1 {
+            return &atom
+        }
+
+        payload := atom.payload()
+        if atom.name == "meta" {
+            if len(payload) < m4aFullAtomHeaderSize {
+                return nil
+            }
+            payload = payload[m4aFullAtomHeaderSize:]
+        }
+        return editor.findAtom(payload, path[1:] ...)
+    }
+    return nil
+}
+
+func (editor *M4aTagEditor) parseItem(tag *Tag, item m4aAtom) {
+    if item.name == "----" {
+        editor.parseFreeformItem(tag, item)
+        return
+    }
+
+    for _, data := range editor.readAtoms(item.payload()) {
+        if data.name != "data" || len(data.payload()) < 8 {
+            continue
+        }
+        dataType := utils.ReadInt24Be(data.payload()[1:4])
+        value := data.payload()[8:]
+
+        switch item.name {
+        case "\xa9nam":
+            tag.Title = string(value)
+        case "\xa9ART":
+            tag.Artist = string(value)
+        case "aART":
+            tag.AlbumArtist = string(value)
+        case "\xa9wrt":
+            tag.Composer = string(value)
+        case "\xa9alb":
+            tag.Album = string(value)
+        case "\xa9cmt":
+            tag.Comment = string(value)
+        case "\xa9gen":
+            tag.Genre = string(value)
+        case "\xa9lyr":
+            setLyrics(tag, string(value))
+        case "\xa9day":
+            tag.Date = ParseDate(string(value))
+        case "gnre":
+            if len(value) >= 2 && len(tag.Genre) == 0 {
+                tag.Genre = genreCodeToString[int(value[0]) * 0x100 + int(value[1]) - 1]
+            }
+        case "trkn":
+            tag.Track, tag.TrackTotal = editor.readNumberPair(value)
+        case "disk":
+            tag.Disc, tag.DiscTotal = editor.readNumberPair(value)
+        case "tmpo":
+            if len(value) >= 2 {
+                tag.BPM = int(value[0]) * 0x100 + int(value[1])
+            }
+        case "cpil":
+            tag.Compilation = len(value) >= 1 && value[len(value) - 1] != 0
+        case "covr":
+            // pictures have no types, the 1st one is considered to be the front cover
+            cover := editor.readCover(dataType, value)
+            if len(tag.Covers) != 0 {
+                cover.Type = imageType[0]
+            }
+            tag.Covers = append(tag.Covers, cover)
+        }
+    }
+}
+
+// parseFreeformItem parses "----" item consisting of mean, name and data atoms
+func (editor *M4aTagEditor) parseFreeformItem(tag *Tag, item m4aAtom) {
+    _, name, value := editor.readFreeformItem(item)
+    if len(name) == 0 {
+        return
+    }
+
+    switch strings.ToUpper(name) {
+    case "ISRC":
+        tag.ISRC = value
+    case "LABEL":
+        tag.Label = value
+    default:
+        if !tag.hasCustom(name) {
+            tag.SetCustom(name, value)
+        }
+    }
+}
+
+// readFreeformItem returns mean, name and the 1st value of free-form item
+func (editor *M4aTagEditor) readFreeformItem(item m4aAtom) (string, string, string) {
+    mean, name, value := "", "", ""
+    for _, atom := range editor.readAtoms(item.payload()) {
+        switch {
+        case atom.name == "mean" && len(atom.payload()) >= m4aFullAtomHeaderSize:
+            mean = string(atom.payload()[m4aFullAtomHeaderSize:])
+        case atom.name == "name" && len(atom.payload()) >= m4aFullAtomHeaderSize:
+            name = string(atom.payload()[m4aFullAtomHeaderSize:])
+        case atom.name == "data" && len(atom.payload()) >= 8 && len(value) == 0:
+            value = string(atom.payload()[8:])
+        }
+    }
+    return mean, name, value
+}
+
+func (editor *M4aTagEditor) makeFreeformItem(mean, name, value string) []byte {
+    dataHeader := make([]byte, 8)
+    utils.WriteInt24Be(m4aDataTypeUtf8, dataHeader[1:4])
+    return editor.makeAtom("----",
+        editor.makeAtom("mean", make([]byte, m4aFullAtomHeaderSize), []byte(mean)),
+        editor.makeAtom("name", make([]byte, m4aFullAtomHeaderSize), []byte(name)),
+        editor.makeAtom("data", dataHeader, []byte(value)))
+}
+
+// readNumberPair reads trkn or disk item value: 2 reserved bytes, number, total
+func (editor *M4aTagEditor) readNumberPair(value []byte) (int, int) {
+    number, total := 0, 0
+    if len(value) >= 4 {
+        number = int(value[2]) * 0x100 + int(value[3])
+    }
+    if len(value) >= 6 {
+        total = int(value[4]) * 0x100 + int(value[5])
+    }
+    return number, total
+}
+
+func (editor *M4aTagEditor) makeNumberPair(number, total int, size int) []byte {
+    value := make([]byte, size)
+    value[2] = byte(number / 0x100)
+    value[3] = byte(number % 0x100)
+    value[4] = byte(total / 0x100)
+    value[5] = byte(total % 0x100)
+    return value
+}
+
+func (editor *M4aTagEditor) readCover(dataType int, value []byte) Cover {
+    var cover Cover
+    switch dataType {
+    case m4aDataTypeJpeg:
+        cover.Mime = "image/jpeg"
+    case m4aDataTypePng:
+        cover.Mime = "image/png"
+    case m4aDataTypeBmp:
+        cover.Mime = "image/bmp"
+    }
+    cover.Type = imageType[3]
+    cover.Data = make([]byte, len(value))
+    copy(cover.Data, value)
+    return cover
+}
+
+func (editor *M4aTagEditor) serializeTag(tag Tag) []byte {
+    result := make([]byte, 0, tag.Size() + 256)
+
+    if len(tag.Title) != 0 {
+        result = append(result, editor.makeTextItem("\xa9nam", tag.Title) ...)
+    }
+    if len(tag.Artist) != 0 {
+        result = append(result, editor.makeTextItem("\xa9ART", tag.Artist) ...)
+    }
+    if len(tag.AlbumArtist) != 0 {
+        result = append(result, editor.makeTextItem("aART", tag.AlbumArtist) ...)
+    }
+    if len(tag.Album) != 0 {
+        result = append(result, editor.makeTextItem("\xa9alb", tag.Album) ...)
+    }
+    if tag.Track != 0 {
+        value := editor.makeNumberPair(tag.Track, tag.TrackTotal, 8)
+        result = append(result, editor.makeItem("trkn", m4aDataTypeImplicit, value) ...)
+    }
+    if tag.Disc != 0 {
+        value := editor.makeNumberPair(tag.Disc, tag.DiscTotal, 6)
+        result = append(result, editor.makeItem("disk", m4aDataTypeImplicit, value) ...)
+    }
+    if !tag.Date.Empty() {
+        result = append(result, editor.makeTextItem("\xa9day", tag.Date.String()) ...)
+    }
+    if len(tag.Comment) != 0 {
+        result = append(result, editor.makeTextItem("\xa9cmt", tag.Comment) ...)
+    }
+    if len(tag.Genre) != 0 {
+        result = append(result, editor.makeTextItem("\xa9gen", tag.Genre) ...)
+    }
+    if len(tag.Composer) != 0 {
+        result = append(result, editor.makeTextItem("\xa9wrt", tag.Composer) ...)
+    }
+    if tag.BPM != 0 {
+        value := []byte{byte(tag.BPM / 0x100), byte(tag.BPM % 0x100)}
+        result = append(result, editor.makeItem("tmpo", m4aDataTypeInteger, value) ...)
+    }
+    if tag.Compilation {
+        result = append(result, editor.makeItem("cpil", m4aDataTypeInteger, []byte{1}) ...)
+    }
+    if lyrics := tag.lyricsText(); len(lyrics) != 0 {
+        result = append(result, editor.makeTextItem("\xa9lyr", lyrics) ...)
+    }
+    if len(tag.ISRC) != 0 {
+        result = append(result, editor.makeFreeformItem(m4aFreeformMean, "ISRC", tag.ISRC) ...)
+    }
+    if len(tag.Label) != 0 {
+        result = append(result, editor.makeFreeformItem(m4aFreeformMean, "LABEL", tag.Label) ...)
+    }
+    for _, key := range tag.customKeys() {
+        if len(tag.Custom[key]) != 0 {
+            result = append(result, editor.makeFreeformItem(m4aFreeformMean, key, tag.Custom[key]) ...)
+        }
+    }
+    if len(tag.Covers) != 0 {
+        result = append(result, editor.makeCoverItem(tag) ...)
+    }
+
+    return result
+}
+
+// makeCoverItem makes covr item with all pictures, the front cover goes first
+func (editor *M4aTagEditor) makeCoverItem(tag Tag) []byte {
+    covers := make([]Cover, 0, len(tag.Covers))
+    for _, cover := range tag.Covers {
+        if cover.TypeCode() == frontCoverType {
+            covers = append([]Cover{cover}, covers ...)
+        } else {
+            covers = append(covers, cover)
+        }
+    }
+
+    pictures := make([][]byte, 0, len(covers))
+    for _, cover := range covers {
+        dataType := m4aDataTypeJpeg
+        switch cover.Mime {
+        case "image/png":
+            dataType = m4aDataTypePng
+        case "image/bmp":
+            dataType = m4aDataTypeBmp
+        }
+        header := make([]byte, 8)
+        utils.WriteInt24Be(dataType, header[1:4])
+        pictures = append(pictures, editor.makeAtom("data", header, cover.Data))
+    }
+
+    return editor.makeAtom("covr", pictures ...)
+}
+
+func (editor *M4aTagEditor) makeTextItem(name, text string) []byte {
+    return editor.makeItem(name, m4aDataTypeUtf8, []byte(text))
+}
+
+func (editor *M4aTagEditor) makeItem(name string, dataType int, value []byte) []byte {
+    header := make([]byte, 8)
+    utils.WriteInt24Be(dataType, header[1:4])
+    return editor.makeAtom(name, editor.makeAtom("data", header, value))
+}
+
+func (editor *M4aTagEditor) makeAtom(name string, payload ...[]byte) []byte {
+    size := m4aAtomHeaderSize
+    for _, data := range payload {
+        size += len(data)
+    }
+
+    result := make([]byte, m4aAtomHeaderSize, size)
+    utils.WriteInt32Be(size, result[0:4])
+    copy(result[4:8], name)
+    for _, data := range payload {
+        result = append(result, data ...)
+    }
+    return result
+}
+
+// getUnsupportedItems returns items not covered by the tag and the tag without custom fields written with them:
+// free-form items are kept as is if the custom field has the value of the 1st item of the name, so all values
+// are kept, otherwise the 1st item is rewritten keeping its mean and name
+func (editor *M4aTagEditor) getUnsupportedItems(items []byte, tag Tag) ([]byte, Tag) {
+    result := make([]byte, 0, len(items))
+    // free-form items overridden by custom fields, true if they are not changed
+    untouched := make(map[string]bool)
+
+    for _, item := range editor.readAtoms(items) {
+        switch item.name {
+        case "\xa9nam", "\xa9ART", "\xa9alb", "trkn", "\xa9day", "\xa9cmt", "\xa9gen", "gnre", "covr",
+             "aART", "disk", "\xa9wrt", "tmpo", "cpil", "\xa9lyr":
+            break
+        case "----":
+            mean, name, value := editor.readFreeformItem(item)
+            key := strings.ToUpper(name)
+            same, found := untouched[key]
+            switch {
+            case key == "ISRC" || key == "LABEL":
+                break
+            case !tag.hasCustom(key) || found && same:
+                result = append(result, item.data ...)
+            case !found:
+                untouched[key] = tag.Custom[key] == value
+                if untouched[key] {
+                    result = append(result, item.data ...)
+                } else if len(tag.Custom[key]) != 0 {
+                    result = append(result, editor.makeFreeformItem(mean, name, tag.Custom[key]) ...)
+                }
+            }
+        default:
+            // custom field named after item atom removes the item
+            if !tag.hasCustom(editor.itemKey(item.name)) {
+                result = append(result, item.data ...)
+            }
+        }
+    }
+
+    written := make(map[string]bool, len(untouched))
+    for key := range untouched {
+        written[key] = true
+    }
+    return result, tag.withoutCustom(written)
+}
+
+// itemKey converts item atom name from Latin-1, so names like '\xa9lyr' are written as '©lyr'
+func (editor *M4aTagEditor) itemKey(name string) string {
+    runes := make([]rune, 0, len(name))
+    for i := 0; i < len(name); i++ {
+        runes = append(runes, rune(name[i]))
+    }
+    return string(runes)
+}
+
+// makeNewMoov replaces ilst atom and free atoms of meta atom, padding is the size of free atom put after
+// the items including its header, no free atom is added if it is 0
+func (editor *M4aTagEditor) makeNewMoov(moov m4aAtom, ilst []byte, padding int) []byte {
+    udta := editor.replaceChild(moov.payload(), "udta", func(udta []byte) []byte {
+        return editor.replaceChild(udta, "meta", func(meta []byte) []byte {
+            if len(meta) < m4aFullAtomHeaderSize {
+                meta = append(make([]byte, m4aFullAtomHeaderSize), editor.makeHandler() ...)
+            }
+            children := editor.replaceChild(meta[m4aFullAtomHeaderSize:], "ilst", func([]byte) []byte {
+                return ilst[m4aAtomHeaderSize:]
+            })
+            result := append([]byte{}, meta[:m4aFullAtomHeaderSize] ...)
+            for _, atom := range editor.readAtoms(children) {
+                if atom.name != "free" {
+                    result = append(result, atom.data ...)
+                }
+            }
+            if padding > 0 {
+                result = append(result, editor.makeAtom("free", make([]byte, padding - m4aAtomHeaderSize)) ...)
+            }
+            return result
+        })
+    })
+    return editor.makeAtom("moov", udta)
+}
+
+// replaceChild rebuilds container payload with the named child atom payload replaced by
+// the result of update, the child is appended to the end if it does not exist
+func (editor *M4aTagEditor) replaceChild(container []byte, name string, update func([]byte) []byte) []byte {
+    result := make([]byte, 0, len(container))
+    found := false
+
+    for _, atom := range editor.readAtoms(container) {
+        if atom.name == name && !found {
+            result = append(result, editor.makeAtom(name, update(atom.payload())) ...)
+            found = true
+        } else {
+            result = append(result, atom.data ...)
+        }
+    }
+
+    if !found {
+        result = append(result, editor.makeAtom(name, update(nil)) ...)
+    }
+    return result
+}
+
+func (editor *M4aTagEditor) makeHandler() []byte {
+    payload := make([]byte, 25)
+    copy(payload[8:12], "mdir")
+    copy(payload[12:16], "appl")
+    return editor.makeAtom("hdlr", payload)
+}
+
+// fixChunkOffsets shifts every stco/co64 entry pointing after the end of the old moov atom
+func (editor *M4aTagEditor) fixChunkOffsets(moov []byte, moovEnd, delta int) error {
+    if delta == 0 {
+        return nil
+    }
+
+    for _, atom := range editor.readAtoms(moov) {
+        var err error
+        switch atom.name {
+        case "trak", "mdia", "minf", "stbl":
+            err = editor.fixChunkOffsets(atom.payload(), moovEnd, delta)
+        case "stco":
+            err = editor.fixOffsetTable(atom.payload(), 4, moovEnd, delta)
+        case "co64":
+            err = editor.fixOffsetTable(atom.payload(), 8, moovEnd, delta)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (editor *M4aTagEditor) fixOffsetTable(table []byte, entrySize, moovEnd, delta int) error {
+    if len(table) < 8 {
+        return errors.New("chunk offset table is too short")
+    }
+
+    entries := utils.ReadInt32Be(table[4:8])
+    table = table[8:]
+    if len(table) < entries * entrySize {
+        return errors.New("chunk offset table is incomplete")
+    }
+
+    for i := 0; i < entries; i++ {
+        entry := table[i * entrySize : (i + 1) * entrySize]
+        offset := 0
+        for _, b := range entry {
+            offset = offset * 0x100 + int(b)
+        }
+        if offset < moovEnd {
+            continue
+        }
+
+        offset += delta
+        if entrySize == 4 && offset > 0xFFFFFFFF {
+            return errors.New("chunk offset does not fit into stco atom")
+        }
+        for j := entrySize - 1; j >= 0; j-- {
+            entry[j] = byte(offset % 0x100)
+            offset = offset / 0x100
+        }
+    }
+    return nil
+}
@@ -0,0 +1,226 @@
+package editor
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+// makeTestM4a makes ftyp, moov and mdat atoms, moov holds chunk offset table of a single entry pointing to audio,
+// entrySize is 4 for stco table and 8 for co64 one
+func makeTestM4a(moovFirst bool, entrySize int) []byte {
+    editor := &M4aTagEditor{}
+    ftyp := editor.makeAtom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+    mdat := editor.makeAtom("mdat", testAudio)
+    makeMoov := func(offset int) []byte {
+        table := make([]byte, 8 + entrySize)
+        utils.WriteInt32Be(1, table[4:8])
+        utils.WriteInt32Be(offset, table[len(table) - 4:])
+        name := "stco"
+        if entrySize == 8 {
+            name = "co64"
+        }
+        return editor.makeAtom("moov",
+            editor.makeAtom("mvhd", make([]byte, 100)),
+            editor.makeAtom("trak", editor.makeAtom("mdia", editor.makeAtom("minf", editor.makeAtom("stbl",
+                editor.makeAtom(name, table))))))
+    }
+
+    if moovFirst {
+        moovSize := len(makeMoov(0))
+        return append(append(ftyp, makeMoov(len(ftyp) + moovSize + m4aAtomHeaderSize) ...), mdat ...)
+    }
+    return append(append(ftyp, mdat ...), makeMoov(len(ftyp) + m4aAtomHeaderSize) ...)
+}
+
+// readTestChunkOffset returns the 1st entry of stco or co64 table
+func readTestChunkOffset(t *testing.T, data []byte) int {
+    editor := &M4aTagEditor{}
+    moov, err := editor.findMoov(bytes.NewReader(data), int64(len(data)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    stbl := []string{"trak", "mdia", "minf", "stbl"}
+    table := editor.findAtom(moov.payload(), append(stbl, "stco") ...)
+    if table == nil {
+        table = editor.findAtom(moov.payload(), append(stbl, "co64") ...)
+    }
+    if table == nil || len(table.payload()) < 12 {
+        t.Fatal("chunk offset table is not found")
+    }
+    return utils.ReadInt32Be(table.payload()[len(table.payload()) - 4:])
+}
+
+func TestM4aChunkOffsets(t *testing.T) {
+    files := []struct {
+        name string
+        moovFirst bool
+        entrySize int
+    }{
+        {"stco/moov before mdat", true, 4},
+        {"stco/moov after mdat", false, 4},
+        {"co64/moov before mdat", true, 8},
+    }
+    // tags make moov atom bigger, then smaller
+    tags := []Tag{
+        {Title: "title", Artist: "Artist", Covers: []Cover{{Mime: "image/png", Data: make([]byte, 1000)}}},
+        {Title: strings.Repeat("long title", 50)},
+        {Title: "x"},
+    }
+
+    for _, file := range files {
+        t.Run(file.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "test.m4a")
+            if err := ioutil.WriteFile(path, makeTestM4a(file.moovFirst, file.entrySize), 0644); err != nil {
+                t.Fatal(err)
+            }
+            editor := NewEditor(M4a)
+
+            for _, tag := range tags {
+                writeTestTag(t, editor, path, tag)
+                checkTestTag(t, editor, path, tag)
+
+                data, err := ioutil.ReadFile(path)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                offset := readTestChunkOffset(t, data)
+                if offset < 0 || offset + len(testAudio) > len(data) || !bytes.Equal(data[offset : offset + len(testAudio)], testAudio) {
+                    t.Errorf("chunk offset %v does not point to audio", offset)
+                }
+            }
+        })
+    }
+}
+
+func TestFixOffsetTable(t *testing.T) {
+    tests := []struct {
+        name string
+        entrySize int
+        offsets []int
+        delta int
+        expected []int
+        fails bool
+    }{
+        {"stco", 4, []int{10, 100, 200}, 16, []int{10, 116, 216}, false},
+        {"stco shrink", 4, []int{100, 200}, -16, []int{84, 184}, false},
+        {"co64", 8, []int{10, 0x100000000}, 8, []int{10, 0x100000008}, false},
+        {"stco overflow", 4, []int{0xFFFFFFF0}, 0x20, nil, true},
+    }
+
+    // offsets before the end of moov atom are not changed
+    const moovEnd = 50
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            table := make([]byte, 8 + len(test.offsets) * test.entrySize)
+            utils.WriteInt32Be(len(test.offsets), table[4:8])
+            for i, offset := range test.offsets {
+                writeTestOffset(table[8 + i * test.entrySize : 8 + (i + 1) * test.entrySize], offset)
+            }
+
+            editor := &M4aTagEditor{}
+            err := editor.fixOffsetTable(table, test.entrySize, moovEnd, test.delta)
+            if (err != nil) != test.fails {
+                t.Fatalf("error: %v", err)
+            }
+            for i, expected := range test.expected {
+                if offset := readTestOffset(table[8 + i * test.entrySize : 8 + (i + 1) * test.entrySize]); offset != expected {
+                    t.Errorf("offset %v is %v, expected %v", i, offset, expected)
+                }
+            }
+        })
+    }
+}
+
+func writeTestOffset(entry []byte, offset int) {
+    for i := len(entry) - 1; i >= 0; i-- {
+        entry[i] = byte(offset)
+        offset >>= 8
+    }
+}
+
+func readTestOffset(entry []byte) int {
+    result := 0
+    for _, b := range entry {
+        result = result << 8 | int(b)
+    }
+    return result
+}
+
+func TestM4aItems(t *testing.T) {
+    tag := Tag{
+        Title: "Title",
+        Artist: "Artist",
+        AlbumArtist: "Album Artist",
+        Album: "Album",
+        Track: 3,
+        TrackTotal: 12,
+        Disc: 1,
+        DiscTotal: 2,
+        Date: Date{Year: 1999, Month: 12, Day: 31},
+        Comment: "Comment",
+        Genre: "Rock",
+        Composer: "Composer",
+        BPM: 120,
+        ISRC: "USABC1234567",
+        Label: "Label",
+        Compilation: true,
+        Lyrics: "Lyrics",
+        Covers: []Cover{{Mime: "image/jpeg", Type: imageType[3], Data: []byte{1, 2, 3}}},
+        Custom: map[string]string{"MOOD": "Calm"},
+    }
+
+    path := filepath.Join(t.TempDir(), "test.m4a")
+    if err := ioutil.WriteFile(path, makeTestM4a(true, 4), 0644); err != nil {
+        t.Fatal(err)
+    }
+    editor := NewEditor(M4a)
+    writeTestTag(t, editor, path, tag)
+    result, err := editor.ReadTag(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.String() != tag.String() {
+        t.Errorf("wrong tag:\n%v\nexpected:\n%v", result, tag)
+    }
+}
+
+func TestM4aOptions(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.m4a")
+    if err := ioutil.WriteFile(path, makeTestM4a(true, 4), 0644); err != nil {
+        t.Fatal(err)
+    }
+    options := DefaultOptions()
+    options.InPlace = true
+    options.Genres = GenreMap{Aliases: map[string]string{"hip hop": "Hip-Hop"}}
+    editor := NewEditor(M4a, options)
+
+    // the 1st update adds padding, the 2nd one fits into it
+    writeTestTag(t, editor, path, Tag{Title: "first", Genre: "hip hop"})
+    before := statTestFile(t, path)
+    writeTestTag(t, editor, path, Tag{Title: "second", Artist: "Artist", Genre: "hip hop; 17"})
+    after := statTestFile(t, path)
+    if !os.SameFile(before, after) || before.Size() != after.Size() {
+        t.Error("file is not overwritten in place")
+    }
+
+    tag, err := editor.ReadTag(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tag.Title != "second" || tag.Artist != "Artist" || tag.Genre != "Hip-Hop; Rock" {
+        t.Errorf("wrong tag:\n%v", tag)
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if offset := readTestChunkOffset(t, data); !bytes.Equal(data[offset : offset + len(testAudio)], testAudio) {
+        t.Errorf("chunk offset %v does not point to audio", offset)
+    }
+}
@@ -2,9 +2,12 @@ package editor
 
 import (
     "bytes"
-    "io/ioutil"
+    "errors"
+    "fmt"
+    "io"
     "strconv"
     "strings"
+    "time"
 
     "github.com/mzinin/tagger/utils"
 )
@@ -19,97 +22,290 @@ const (
 )
 
 type Mp3TagEditor struct {
-    file []byte
+    options Options
+}
+
+// mp3FileParts describes MP3 file: tags data and position of sound data between them
+type mp3FileParts struct {
+    id3v1TagData []byte
+    apeTagData []byte
+    frames23 []id3v2Frame
+    frames24 []id3v2Frame
+    soundOffset int64
+    soundSize int64
 }
 
 func (editor *Mp3TagEditor) ReadTag(path string) (Tag, error) {
-    err := editor.readFile(path)
+    file, size, err := openFile(path)
     if err != nil {
         return Tag{}, err
     }
+    defer file.Close()
 
-    tag10Data, tag23Data, tag24Data, _ := editor.splitFileData(editor.file)
+    parts, err := editor.splitFile(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
 
-    tag10 := editor.parseID3v1Tag(tag10Data)
-    tag23 := editor.parseID3v2Tag(tag23Data, 3)
-    tag24 := editor.parseID3v2Tag(tag24Data, 4)
+    tag10 := editor.parseID3v1Tag(parts.id3v1TagData)
+    tagApe := parseApeTag(parts.apeTagData)
+    tag23 := editor.parseID3v2Tag(parts.frames23, 3)
+    tag24 := editor.parseID3v2Tag(parts.frames24, 4)
 
     tag23.MergeWith(tag24)
+    tag23.MergeWith(tagApe)
     tag23.MergeWith(tag10)
+    tag23.Genre = editor.options.Genres.Normalize(tag23.Genre)
 
     return tag23, nil
 }
 
 func (editor *Mp3TagEditor) WriteTag(src, dst string, tag Tag) error {
-    err := editor.readFile(src)
+    file, size, err := openFile(src)
     if err != nil {
         return err
     }
+    defer file.Close()
 
-    _, existingTagData, _, soundData := editor.splitFileData(editor.file)
+    parts, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+
+    id3v1TagData := parts.id3v1TagData
+    switch {
+    case editor.options.ID3v1Policy == UpdateTag,
+         editor.options.ID3v1Policy == UpdateExistingTag && len(id3v1TagData) != 0:
+        id3v1TagData = editor.serializeID3v1Tag(tag)
+    case editor.options.ID3v1Policy == StripTag:
+        id3v1TagData = nil
+    }
 
-    newTagData := editor.makeNewID3v23TagData(existingTagData, tag)
-    return ioutil.WriteFile(dst, append(newTagData, soundData ...), 0666)
+    apeTagData := parts.apeTagData
+    switch {
+    case editor.options.ApePolicy == UpdateTag,
+         editor.options.ApePolicy == UpdateExistingTag && len(apeTagData) != 0:
+        apeTagData = serializeApeTag(tag, apeTagData)
+    case editor.options.ApePolicy == StripTag:
+        apeTagData = nil
+    }
+
+    if len(tag.Chapters) != 0 {
+        // CHAP frames require end time, so the last chapter ends with the recording
+        if properties, err := editor.ReadProperties(src); err == nil {
+            tag.Chapters = completeChapters(tag.Chapters, properties.Duration)
+        }
+    }
+
+    newTagData := editor.makeNewID3v2TagData(parts.frames23, parts.frames24, tag, 0)
+    oldTailSize := len(parts.apeTagData) + len(parts.id3v1TagData)
+    newTail := append(append([]byte{}, apeTagData ...), id3v1TagData ...)
+
+    // overwrite only tags if the new ID3v2 tag fits into the existing one and tail size is not changed
+    if editor.options.InPlace && isSameFile(file, dst) && len(newTagData) <= int(parts.soundOffset) && len(newTail) == oldTailSize {
+        newTagData = editor.makeNewID3v2TagData(parts.frames23, parts.frames24, tag, int(parts.soundOffset) - len(newTagData))
+        return writeAt(dst, fileRegion{0, newTagData}, fileRegion{size - int64(len(newTail)), newTail})
+    }
+
+    builder := newFileBuilder(file)
+    builder.appendData(editor.makeNewID3v2TagData(parts.frames23, parts.frames24, tag, editor.options.Padding))
+    builder.appendRange(parts.soundOffset, parts.soundSize)
+    builder.appendData(newTail)
+    return builder.save(dst)
 }
 
-func (editor *Mp3TagEditor) readFile(path string) error {
-    var err error
-    editor.file, err = ioutil.ReadFile(path)
-    return err
+// RemoveTag removes all ID3v2, APEv2 and ID3v1 tags regardless of tag policies
+func (editor *Mp3TagEditor) RemoveTag(src, dst string) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    parts, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    builder := newFileBuilder(file)
+    builder.appendRange(parts.soundOffset, parts.soundSize)
+    return builder.save(dst)
 }
 
-func (editor *Mp3TagEditor) splitFileData(data []byte) ([]byte, []byte, []byte, []byte) {
-    var id3v1TagData []byte = nil
-    if len(data) > id3v1TagSize && string(data[len(data) - id3v1TagSize : len(data) - id3v1TagSize + 3]) == id3v1TagMagic {
-        id3v1TagData = data[len(editor.file) - id3v1TagSize:]
-        data = data[:len(editor.file) - id3v1TagSize]
+// ReadProperties parses the 1st MPEG frame header and Xing, VBRI or LAME header inside the frame,
+// CBR duration is estimated by the sound data size
+func (editor *Mp3TagEditor) ReadProperties(path string) (Properties, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Properties{}, err
     }
+    defer file.Close()
 
-    id3v23TagData := editor.findIDv2Data(3, data)
-    id3v24TagData := editor.findIDv2Data(4, data)
+    parts, err := editor.splitFile(file, size)
+    if err != nil {
+        return Properties{}, err
+    }
 
-    for len(data) > id3v2HeaderSize && string(data[0:3]) == id3v2TagMagic {
-        tagSize := editor.readSyncInt32Be(data[6:10])
-        data = data[id3v2HeaderSize + tagSize:]
+    // some junk may precede the 1st frame
+    searchSize := int64(mpegSearchSize)
+    if searchSize > parts.soundSize {
+        searchSize = parts.soundSize
+    }
+    data, err := readAt(file, parts.soundOffset, int(searchSize))
+    if err != nil {
+        return Properties{}, err
     }
 
-    return id3v1TagData, id3v23TagData, id3v24TagData, data
+    for i := 0; i + 4 <= len(data); i++ {
+        header, ok := parseMpegFrameHeader(data[i : i + 4])
+        if !ok {
+            continue
+        }
+        // sync bits in junk are unlikely to be followed by a header of the same stream
+        if next := i + header.frameSize; next + 4 <= len(data) {
+            nextHeader, ok := parseMpegFrameHeader(data[next : next + 4])
+            if !ok || nextHeader.version != header.version || nextHeader.layer != header.layer || nextHeader.sampleRate != header.sampleRate {
+                continue
+            }
+        }
+        frame := data[i:]
+        if len(frame) > header.frameSize {
+            frame = frame[:header.frameSize]
+        }
+        return editor.makeProperties(header, frame, parts.soundSize - int64(i)), nil
+    }
+    return Properties{}, errors.New("no MPEG frame found")
 }
 
-func (editor *Mp3TagEditor) findIDv2Data(version byte, data []byte) []byte {
-    if len(data) < id3v2HeaderSize {
-        return nil
+func (editor *Mp3TagEditor) makeProperties(header mpegFrameHeader, frame []byte, soundSize int64) Properties {
+    properties := Properties{
+        Codec: "MP" + strconv.Itoa(header.layer),
+        Bitrate: header.bitrate,
+        SampleRate: header.sampleRate,
+        Channels: header.channels,
     }
-    if string(data[0:3]) != id3v2TagMagic {
-        return nil
+
+    frames, dataSize, delay := editor.readVbrHeader(header, frame)
+    if frames > 0 {
+        samples := int64(frames) * int64(header.samplesPerFrame) - int64(delay)
+        properties.Duration = samplesDuration(samples, header.sampleRate)
+        if dataSize <= 0 {
+            dataSize = soundSize
+        }
+        properties.Bitrate = averageBitrate(dataSize, properties.Duration)
+    } else if header.bitrate > 0 {
+        properties.Duration = time.Duration(soundSize * 8 * int64(time.Millisecond) / int64(header.bitrate))
     }
+    return properties
+}
 
-    size := editor.readSyncInt32Be(data[6:10])
-    if len(data) < id3v2HeaderSize + size || size == 0 {
-        return nil
+// readVbrHeader returns number of frames, bytes and encoder delay with padding in samples,
+// zero number of frames means there is no VBR header
+func (editor *Mp3TagEditor) readVbrHeader(header mpegFrameHeader, frame []byte) (int, int64, int) {
+    // Xing header follows side information, "Info" is written by LAME for CBR files
+    xing := 4 + header.sideInfoSize
+    if len(frame) >= xing + 8 && (string(frame[xing : xing + 4]) == "Xing" || string(frame[xing : xing + 4]) == "Info") {
+        flags := utils.ReadInt32Be(frame[xing + 4 : xing + 8])
+        position := xing + 8
+        frames, dataSize := 0, int64(0)
+        if flags & 0x1 != 0 && len(frame) >= position + 4 {
+            frames = utils.ReadInt32Be(frame[position : position + 4])
+            position += 4
+        }
+        if flags & 0x2 != 0 && len(frame) >= position + 4 {
+            dataSize = int64(utils.ReadInt32Be(frame[position : position + 4]))
+            position += 4
+        }
+        if flags & 0x4 != 0 {
+            position += 100
+        }
+        if flags & 0x8 != 0 {
+            position += 4
+        }
+
+        // LAME extension starts with 9 bytes of encoder version, delay and padding are 12 bits each
+        delay := 0
+        if len(frame) >= position + 24 {
+            lame := frame[position:]
+            if string(lame[0:4]) == "LAME" || string(lame[0:4]) == "Lavc" || string(lame[0:4]) == "Lavf" {
+                delay = utils.ReadInt24Be(lame[21:24]) >> 12 + utils.ReadInt24Be(lame[21:24]) & 0xFFF
+            }
+        }
+        return frames, dataSize, delay
     }
 
-    // wrong version, continue search
-    if data[3] != version || data[4] != 0 {
-        return editor.findIDv2Data(version, data[(id3v2HeaderSize + size):])
+    // VBRI header is placed right after 32 bytes following the frame header
+    vbri := 4 + 32
+    if len(frame) >= vbri + 18 && string(frame[vbri : vbri + 4]) == "VBRI" {
+        return utils.ReadInt32Be(frame[vbri + 14 : vbri + 18]), int64(utils.ReadInt32Be(frame[vbri + 10 : vbri + 14])), 0
     }
 
-    // exclude extended header if any
-    extendedHeaderSize := 0
-    if data[5] & 0x40 != 0 {
-        switch version {
-        case 3:
-            extendedHeaderSize = utils.ReadInt32Be(data[11:15]) + 4
-        case 4:
-            extendedHeaderSize = editor.readSyncInt32Be(data[11:15])
+    return 0, 0, 0
+}
+
+// splitFile reads tags placed in the beginning and in the end of file, sound data between them is not read
+func (editor *Mp3TagEditor) splitFile(file io.ReaderAt, size int64) (mp3FileParts, error) {
+    var parts mp3FileParts
+    end := size
+
+    if end > int64(id3v1TagSize) {
+        data, err := readAt(file, end - int64(id3v1TagSize), id3v1TagSize)
+        if err != nil {
+            return parts, err
+        }
+        if string(data[0:3]) == id3v1TagMagic {
+            parts.id3v1TagData = data
+            end -= int64(id3v1TagSize)
+        }
+    }
+
+    apeTagData, err := readApeTag(file, end)
+    if err != nil {
+        return parts, err
+    }
+    parts.apeTagData = apeTagData
+    end -= int64(len(apeTagData))
+
+    tagsData, err := editor.readID3v2TagsData(file, end)
+    if err != nil {
+        return parts, err
+    }
+    if parts.frames23, parts.frames24, _, err = editor.readID3v2Tags(tagsData); err != nil {
+        return parts, err
+    }
+
+    parts.soundOffset = int64(len(tagsData))
+    parts.soundSize = end - parts.soundOffset
+    return parts, nil
+}
+
+// readID3v2TagsData reads all ID3v2 tags in the beginning of file, but not further than end
+func (editor *Mp3TagEditor) readID3v2TagsData(file io.ReaderAt, end int64) ([]byte, error) {
+    size := int64(0)
+    for size + int64(id3v2HeaderSize) <= end {
+        header, err := readAt(file, size, id3v2HeaderSize)
+        if err != nil {
+            return nil, err
+        }
+        if string(header[0:3]) != id3v2TagMagic {
+            break
+        }
+
+        size += int64(id3v2HeaderSize + editor.readSyncInt32Be(header[6:10]))
+        if header[3] == 4 && header[5] & 0x10 != 0 {
+            size += int64(id3v2HeaderSize)
         }
     }
 
-    return data[(id3v2HeaderSize + extendedHeaderSize):(id3v2HeaderSize + extendedHeaderSize + size)]
+    if size > end {
+        return nil, errors.New("ID3v2 tag is truncated")
+    }
+    return readAt(file, 0, int(size))
 }
 
 func (editor *Mp3TagEditor) readSyncInt32Be(data []byte) int {
-    return ((int(data[0]) * 0x80 + int(data[1])) * 0x80 + int(data[2])) * 0x80 + int(data[3])
+    return utils.ReadSyncInt32Be(data)
 }
 
 func (editor *Mp3TagEditor) writeSyncInt32Be(size int, dst []byte) {
@@ -129,82 +325,333 @@ func (editor *Mp3TagEditor) parseID3v1Tag(data []byte) Tag {
 
     var tag Tag
 
-    tag.Title = strings.Trim(string(data[3:33]), " ")
-    tag.Artist = strings.Trim(string(data[33:63]), " ")
-    tag.Album = strings.Trim(string(data[63:93]), " ")
-    tag.Year, _ = strconv.Atoi(string(data[93:97]))
+    tag.Title = editor.decodeID3v1Text(data[3:33])
+    tag.Artist = editor.decodeID3v1Text(data[33:63])
+    tag.Album = editor.decodeID3v1Text(data[63:93])
+    tag.Date.Year, _ = strconv.Atoi(string(data[93:97]))
     switch data[125] {
     case 0:
-        tag.Comment = strings.Trim(string(data[97:125]), " \0000")
+        tag.Comment = editor.decodeID3v1Text(data[97:125])
         tag.Track = int(data[126])
     default:
-        tag.Comment = strings.Trim(string(data[97:127]), " \0000")
+        tag.Comment = editor.decodeID3v1Text(data[97:127])
     }
     tag.Genre = genreCodeToString[int(data[127])]
 
     return tag
 }
 
-func (editor *Mp3TagEditor) parseID3v2Tag(data []byte, version int) Tag {
-    if len(data) == 0 {
-        return Tag{}
+// serializeID3v1Tag makes ID3v1.1 tag, text fields are truncated to 30 bytes (28 for comment)
+func (editor *Mp3TagEditor) serializeID3v1Tag(tag Tag) []byte {
+    result := make([]byte, id3v1TagSize)
+    copy(result[0:3], id3v1TagMagic)
+    copy(result[3:33], editor.encodeID3v1Text(tag.Title))
+    copy(result[33:63], editor.encodeID3v1Text(tag.Artist))
+    copy(result[63:93], editor.encodeID3v1Text(tag.Album))
+    if tag.Date.Year > 0 && tag.Date.Year < 10000 {
+        copy(result[93:97], fmt.Sprintf("%04d", tag.Date.Year))
+    }
+    copy(result[97:125], editor.encodeID3v1Text(tag.Comment))
+    result[125] = 0
+    if tag.Track > 0 && tag.Track < 256 {
+        result[126] = byte(tag.Track)
+    }
+    result[127] = 255
+    if genres := SplitValues(tag.Genre); len(genres) != 0 {
+        result[127] = genreStringToCode(genres[0])
+    }
+    return result
+}
+
+// decodeID3v1Text converts text of the configured charset to UTF-8
+func (editor *Mp3TagEditor) decodeID3v1Text(data []byte) string {
+    if pos := bytes.IndexByte(data, 0); pos != -1 {
+        data = data[:pos]
+    }
+    return strings.Trim(editor.decodeLegacyText(data), " ")
+}
+
+// encodeID3v1Text converts text to the configured charset, the result is cut by copying into fixed size field
+func (editor *Mp3TagEditor) encodeID3v1Text(text string) []byte {
+    charset := editor.options.Charset
+    if len(charset) == 0 {
+        charset = utils.Latin1Charset
     }
+    return utils.EncodeCharset(text, charset)
+}
 
-    var tag Tag
-    for len(data) > id3v2FrameHeaderSize {
-        frameId := string(data[0:4])
-        if frameId == "\x00\x00\x00\x00" {
-            break
-        }
+// decodeLegacyText converts 8-bit text of the configured charset to UTF-8
+func (editor *Mp3TagEditor) decodeLegacyText(data []byte) string {
+    charset := editor.options.Charset
+    if len(charset) == 0 {
+        charset = utils.Latin1Charset
+    }
+    return utils.DecodeLegacyText(data, charset)
+}
 
-        frameSize := 0
-        switch version {
-        case 3:
-            frameSize = utils.ReadInt32Be(data[4:8])
-        case 4:
-            frameSize = editor.readSyncInt32Be(data[4:8])
-        }
+// parseID3v2Tags parses ID3v2 tags stored in a container chunk rather than in the beginning of MP3 file
+func (editor *Mp3TagEditor) parseID3v2Tags(data []byte) (Tag, error) {
+    frames23, frames24, _, err := editor.readID3v2Tags(data)
+    if err != nil {
+        return Tag{}, err
+    }
 
-        editor.parseID3v2Frame(&tag, frameId, data[id3v2FrameHeaderSize:(id3v2FrameHeaderSize + frameSize)])
-        data = data[id3v2FrameHeaderSize + frameSize:]
+    tag23 := editor.parseID3v2Tag(frames23, 3)
+    tag24 := editor.parseID3v2Tag(frames24, 4)
+    tag23.MergeWith(tag24)
+    return tag23, nil
+}
+
+func (editor *Mp3TagEditor) parseID3v2Tag(frames []id3v2Frame, version int) Tag {
+    var tag Tag
+    for _, frame := range frames {
+        editor.parseID3v2Frame(&tag, frame.id, frame.data, version)
     }
+    sortChapters(tag.Chapters)
 
     return tag
 }
 
-func (editor *Mp3TagEditor) parseID3v2Frame(tag *Tag, frameId string, frameData []byte) {
+func (editor *Mp3TagEditor) parseID3v2Frame(tag *Tag, frameId string, frameData []byte, version int) {
     switch frameId {
+    case "CHAP":
+        if chapter, ok := editor.readID3v2Chapter(frameData, version); ok {
+            tag.Chapters = append(tag.Chapters, chapter)
+        }
     case "APIC":
-        tag.Cover = editor.readID3v2Cover(frameData)
+        if cover := editor.readID3v2Cover(frameData); !cover.Empty() {
+            tag.Covers = append(tag.Covers, cover)
+        }
     case "COMM":
-        tag.Comment = editor.readID3v2Text(frameData)
+        // the 1st comment without description is the main one
+        if comment, ok := editor.readID3v2Comment(frameData); ok {
+            if len(comment.Description) == 0 && len(tag.Comment) == 0 {
+                tag.Comment = comment.Text
+            } else {
+                tag.Comments = append(tag.Comments, comment)
+            }
+        }
     case "TALB":
         tag.Album = editor.readID3v2Text(frameData)
     case "TCON":
-        tag.Genre = editor.readID3v2Text(frameData)
+        // ID3v2.4 genres are null-separated
+        tag.Genre = editor.options.Genres.Normalize(strings.Join(editor.readID3v2TextValues(frameData), "\x00"))
     case "TIT2":
         tag.Title = editor.readID3v2Text(frameData)
     case "TPE1":
-        tag.Artist = editor.readID3v2Text(frameData)
+        tag.Artist = JoinValues(editor.readID3v2TextValues(frameData) ...)
+    case "TPE2":
+        tag.AlbumArtist = editor.readID3v2Text(frameData)
     case "TRCK":
-        tag.Track, _ = strconv.Atoi(editor.readID3v2Text(frameData))
-    case "TYER":
+        tag.Track, tag.TrackTotal = parseNumberPair(editor.readID3v2Text(frameData))
+    case "TPOS":
+        tag.Disc, tag.DiscTotal = parseNumberPair(editor.readID3v2Text(frameData))
+    case "TCOM":
+        tag.Composer = JoinValues(editor.readID3v2TextValues(frameData) ...)
+    case "TMCL", "IPLS":
+        tag.Performer = JoinValues(editor.readID3v2Performers(frameId, frameData) ...)
+    case "TBPM":
+        tag.BPM, _ = strconv.Atoi(editor.readID3v2Text(frameData))
+    case "TSRC":
+        tag.ISRC = editor.readID3v2Text(frameData)
+    case "TPUB":
+        tag.Label = editor.readID3v2Text(frameData)
+    case "TCMP":
+        tag.Compilation = editor.readID3v2Text(frameData) == "1"
+    case "USLT":
+        // the 1st lyrics frame with text is the main one, others are passed through
+        if len(tag.Lyrics) == 0 {
+            tag.Lyrics = editor.readID3v2Lyrics(frameData)
+        }
+    case "SYLT":
+        if lines := editor.readID3v2SyncedLyrics(frameData); len(lines) != 0 {
+            tag.SyncedLyrics = lines
+        }
+    case "TXXX":
+        // description and values, values of frames with the same description are collected
+        values := editor.splitID3v2TextValues(frameData)
+        if len(values) < 2 || len(values[0]) == 0 {
+            break
+        }
+        value := tag.Custom[strings.ToUpper(values[0])]
+        for _, next := range values[1:] {
+            if len(next) != 0 {
+                appendValue(&value, next)
+            }
+        }
+        tag.SetCustom(values[0], value)
     case "TDRC":
-        tag.Year, _ = strconv.Atoi(editor.readID3v2Text(frameData))
+        tag.Date = ParseDate(editor.readID3v2Text(frameData))
+    case "TYER":
+        tag.Date.Year = ParseDate(editor.readID3v2Text(frameData)).Year
+    case "TDAT":
+        // ddMM, out of range day and month are dropped
+        if text := editor.readID3v2Text(frameData); len(text) == 4 {
+            var date Date
+            date.Day, _ = strconv.Atoi(text[0:2])
+            date.Month, _ = strconv.Atoi(text[2:4])
+            date = date.normalized()
+            tag.Date.Month, tag.Date.Day = date.Month, date.Day
+        }
+    case "TDOR":
+        tag.OriginalDate = ParseDate(editor.readID3v2Text(frameData))
+    case "TORY":
+        if tag.OriginalDate.Empty() {
+            tag.OriginalDate.Year = ParseDate(editor.readID3v2Text(frameData)).Year
+        }
     }
 }
 
 func (editor *Mp3TagEditor) readID3v2Text(data []byte) string {
+    return strings.Join(editor.readID3v2TextValues(data), "/")
+}
+
+// readID3v2TextValues returns all non-empty null-separated values of a text frame
+func (editor *Mp3TagEditor) readID3v2TextValues(data []byte) []string {
+    var result []string
+    for _, value := range editor.splitID3v2TextValues(data) {
+        if len(value) != 0 {
+            result = append(result, value)
+        }
+    }
+    return result
+}
+
+// splitID3v2TextValues returns all null-separated values of a text frame including empty ones,
+// the terminator after the last value does not make an empty value
+func (editor *Mp3TagEditor) splitID3v2TextValues(data []byte) []string {
     if len(data) == 0 {
+        return nil
+    }
+    encoding := data[0]
+    data = data[1:]
+
+    separatorSize := 1
+    if encoding == 1 || encoding == 2 {
+        separatorSize = 2
+    }
+
+    var result []string
+    for len(data) > 0 {
+        end := len(data)
+        for i := 0; i + separatorSize <= len(data); i += separatorSize {
+            if data[i] == 0 && data[i + separatorSize - 1] == 0 {
+                end = i
+                break
+            }
+        }
+
+        result = append(result, editor.decodeText(encoding, data[:end]))
+        if end + separatorSize > len(data) {
+            break
+        }
+        data = data[end + separatorSize:]
+    }
+
+    return result
+}
+
+// readID3v2Chapter reads CHAP frame: element id, start and end time in milliseconds, start and end offsets
+// and sub-frames, title of the chapter is taken from TIT2 sub-frame
+func (editor *Mp3TagEditor) readID3v2Chapter(data []byte, version int) (Chapter, bool) {
+    offset := editor.id3v2SubFramesOffset(id3v2Frame{id: "CHAP", data: data})
+    if offset == -1 {
+        return Chapter{}, false
+    }
+
+    chapter := Chapter{
+        Start: time.Duration(utils.ReadInt32Be(data[offset - 16 : offset - 12])) * time.Millisecond,
+        End: time.Duration(utils.ReadInt32Be(data[offset - 12 : offset - 8])) * time.Millisecond,
+    }
+    if frames, err := editor.readID3v2Frames(data[offset:], version, false); err == nil {
+        chapter.Title = editor.parseID3v2Tag(frames, version).Title
+    }
+    return chapter, true
+}
+
+// readID3v2TerminatedText reads null-terminated text of the encoding and returns the rest of data
+func (editor *Mp3TagEditor) readID3v2TerminatedText(encoding byte, data []byte) (string, []byte) {
+    separatorSize := 1
+    if encoding == 1 || encoding == 2 {
+        separatorSize = 2
+    }
+    for i := 0; i + separatorSize <= len(data); i += separatorSize {
+        if data[i] == 0 && data[i + separatorSize - 1] == 0 {
+            return editor.decodeText(encoding, data[:i]), data[i + separatorSize:]
+        }
+    }
+    return editor.decodeText(encoding, data), nil
+}
+
+// readID3v2Lyrics reads USLT frame: encoding, language, description and text
+func (editor *Mp3TagEditor) readID3v2Lyrics(data []byte) string {
+    if len(data) < 4 {
         return ""
     }
+    _, text := editor.readID3v2TerminatedText(data[0], data[4:])
+    return editor.decodeText(data[0], text)
+}
+
+// readID3v2Performers returns names of musicians from TMCL frame of ID3v2.4, or names of people
+// with 'performer' role from IPLS frame of ID3v2.3, both frames hold role and name pairs
+func (editor *Mp3TagEditor) readID3v2Performers(frameId string, data []byte) []string {
+    var result []string
+    values := editor.splitID3v2TextValues(data)
+    for i := 0; i + 1 < len(values); i += 2 {
+        if len(values[i + 1]) == 0 {
+            continue
+        }
+        if frameId == "TMCL" || strings.EqualFold(values[i], id3v2PerformerRole) {
+            result = append(result, values[i + 1])
+        }
+    }
+    return result
+}
+
+// readID3v2Comment reads COMM frame: encoding, language, description and text
+func (editor *Mp3TagEditor) readID3v2Comment(data []byte) (Comment, bool) {
+    if len(data) < 4 {
+        return Comment{}, false
+    }
+    description, text := editor.readID3v2TerminatedText(data[0], data[4:])
+    return Comment{
+        Language: string(data[1:4]),
+        Description: description,
+        Text: editor.decodeText(data[0], text),
+    }, true
+}
+
+// readID3v2SyncedLyrics reads SYLT frame: encoding, language, timestamp format, content type, description
+// and lines of text followed by time, only lyrics content type and timestamps in milliseconds are supported
+func (editor *Mp3TagEditor) readID3v2SyncedLyrics(data []byte) []LyricsLine {
+    if len(data) < 6 || data[4] != 2 || data[5] != 1 {
+        return nil
+    }
     encoding := data[0]
-    return editor.decodeText(encoding, data[1:])
+    _, data = editor.readID3v2TerminatedText(encoding, data[6:])
+
+    var result []LyricsLine
+    for len(data) > 0 {
+        var text string
+        text, data = editor.readID3v2TerminatedText(encoding, data)
+        if len(data) < 4 {
+            break
+        }
+        // new lines are marked with line feed at the beginning of text
+        result = append(result, LyricsLine{
+            Time: time.Duration(utils.ReadInt32Be(data[:4])) * time.Millisecond,
+            Text: strings.TrimLeft(text, "\r\n"),
+        })
+        data = data[4:]
+    }
+    return result
 }
 
 func (editor *Mp3TagEditor) decodeText(encoding byte, data []byte) string {
     switch encoding {
-    case 0, 3:
+    case 0:
+        return strings.Trim(editor.decodeLegacyText(data), " \x00")
+    case 3:
         return strings.Trim(string(data), " \x00")
     case 1:
         return utils.Utf16LeToUtf8(data)
@@ -221,9 +668,10 @@ func (editor *Mp3TagEditor) readID3v2Cover(data []byte) Cover {
 
     var cover Cover
     encoding := data[0]
+    // MIME type is always ISO-8859-1
     pos := bytes.IndexByte(data[1:], 0)
     if pos != -1 {
-        cover.Mime = editor.decodeText(encoding, data[1:pos + 1])
+        cover.Mime = string(data[1:pos + 1])
         data = data[pos + 2:]
     }
 
@@ -231,11 +679,18 @@ func (editor *Mp3TagEditor) readID3v2Cover(data []byte) Cover {
         return Cover{}
     }
     cover.Type = imageType[data[0]]
+    data = data[1:]
 
-    pos = bytes.IndexByte(data[1:], 0)
-    if pos != -1 {
-        cover.Description = editor.decodeText(encoding, data[1:pos + 1])
-        data = data[pos + 2:]
+    separatorSize := 1
+    if encoding == 1 || encoding == 2 {
+        separatorSize = 2
+    }
+    for i := 0; i + separatorSize <= len(data); i += separatorSize {
+        if data[i] == 0 && data[i + separatorSize - 1] == 0 {
+            cover.Description = editor.decodeText(encoding, data[:i])
+            data = data[i + separatorSize:]
+            break
+        }
     }
 
     cover.Data = make([]byte, len(data))
@@ -244,83 +699,19 @@ func (editor *Mp3TagEditor) readID3v2Cover(data []byte) Cover {
     return cover
 }
 
-func (editor *Mp3TagEditor) makeNewID3v23TagData(existingTagData []byte, tag Tag) []byte {
-    newTags := editor.serializeTag(tag)
-    oldTags := editor.getUnsupportedID3v2Tags(existingTagData)
-    header := editor.makeIdv23TagHeader(len(newTags) + len(oldTags))
-    return append(append(header, newTags ...), oldTags ...)
-}
-
-func (editor *Mp3TagEditor) serializeTag(tag Tag) []byte {
-    // x2 for possible transform into UTF16, 256 bytes for possible overhead
-    result := make([]byte, 2 * tag.Size() + 256)
-    size := 0
-    
-    if len(tag.Title) != 0 {
-        size = editor.serializeTextField(tag.Title, "TIT2", result, size)
-    }
-    if len(tag.Artist) != 0 {
-        size = editor.serializeTextField(tag.Artist, "TPE1", result, size)
-    }
-    if len(tag.Album) != 0 {
-        size = editor.serializeTextField(tag.Album, "TALB", result, size)
-    }
-    if tag.Track != 0 {
-        size = editor.serializeTextField(strconv.Itoa(tag.Track), "TRCK", result, size)
-    }
-    if tag.Year != 0 {
-        size = editor.serializeTextField(strconv.Itoa(tag.Year), "TYER", result, size)
-    }
-    if len(tag.Comment) != 0 {
-        size = editor.serializeTextField(tag.Comment, "COMM", result, size)
-    }
-    if len(tag.Genre) != 0 {
-        size = editor.serializeTextField(tag.Genre, "TCON", result, size)
-    }
-    if !tag.Cover.Empty() {
-        size = editor.serializeCover(tag.Cover, "APIC", result, size)
-    }
-
-    return result[:size]
-}
-
-func (editor *Mp3TagEditor) serializeTextField(text, frameId string, dst []byte, offset int) int {
-    if len(frameId) != id3v2FrameIdSize {
-        return offset
-    }
-
-    utf16Text := utils.Utf8ToUtf16Le(text)
-    copy(dst[offset:], frameId)
-    utils.WriteInt32Be(len(utf16Text) + 3, dst[offset + 4 : offset + 8])
-    dst[offset + 8] = 0 // flag
-    dst[offset + 9] = 0 // flag
-    dst[offset + 10] = 1 // text encoding
-    dst[offset + 11] = 0xFF // UTF BOM
-    dst[offset + 12] = 0xFE // UTF BOM
-    copy(dst[offset + 13 : offset + 13 + len(utf16Text)], utf16Text)
-    return offset + 13 + len(utf16Text)
-}
-
-func (editor *Mp3TagEditor) serializeCover(cover Cover, frameId string, dst []byte, offset int) int {
-    if len(frameId) != id3v2FrameIdSize {
-        return offset
+func (editor *Mp3TagEditor) coverToData(cover Cover) []byte {
+    // non-ASCII description is stored as UTF-16, which is valid in both ID3v2.3 and ID3v2.4
+    description := []byte(cover.Description)
+    encoding := byte(0)
+    if strings.IndexFunc(cover.Description, func(r rune) bool { return r > 0x7F }) != -1 {
+        encoding = 1
+        description = append([]byte{0xFF, 0xFE}, utils.Utf8ToUtf16Le(cover.Description) ...)
     }
 
-    data := editor.coverToData(cover)
-    copy(dst[offset:], frameId)
-    utils.WriteInt32Be(len(data), dst[offset + 4 : offset + 8])
-    dst[offset + 8] = 0 // flag
-    dst[offset + 9] = 0 // flag
-    copy(dst[offset + 10 : offset + 10 + len(data)], data)
-
-    return offset + 10 + len(data)
-}
-
-func (editor *Mp3TagEditor) coverToData(cover Cover) []byte {
-    result := make([]byte, cover.Size() + 128)
+    result := make([]byte, cover.Size() + len(description) + 128)
     size := 0
 
-    result[0] = 0 // encoding
+    result[0] = encoding
     size++
 
     copy(result[size : size + len(cover.Mime)], cover.Mime)
@@ -329,88 +720,21 @@ func (editor *Mp3TagEditor) coverToData(cover Cover) []byte {
     result[size] = 0
     size++
 
-    // TODO care for cover type
-    result[size] = 3 // cover type
+    result[size] = cover.TypeCode()
     size++
 
-    copy(result[size : size + len(cover.Description)], cover.Description)
-    size += len(cover.Description)
+    copy(result[size : size + len(description)], description)
+    size += len(description)
 
     result[size] = 0
     size++
+    if encoding == 1 {
+        result[size] = 0
+        size++
+    }
 
     copy(result[size : size + len(cover.Data)], cover.Data)
     size += len(cover.Data)
 
     return result[:size]
 }
-
-func (editor *Mp3TagEditor) getUnsupportedID3v2Tags(existingTagData []byte) []byte {
-    result := make([]byte, len(existingTagData))
-    size := 0
-
-    for len(existingTagData) > id3v2FrameHeaderSize {
-        frameId := string(existingTagData[0:4])
-        frameSize := utils.ReadInt32Be(existingTagData[4:8])
-
-        stop := false
-        switch frameId {
-        case "\x00\x00\x00\x00":
-            stop = true
-        case "APIC", "COMM", "TALB", "TCON", "TIT2", "TPE1", "TRCK", "TYER", "TDRC":
-            break
-        default:
-            copy(result[size : size + id3v2FrameHeaderSize + frameSize], existingTagData[:id3v2FrameHeaderSize + frameSize])
-            size += id3v2FrameHeaderSize + frameSize
-        }
-
-        if stop {
-            break
-        }
-
-        existingTagData = existingTagData[id3v2FrameHeaderSize + frameSize:]
-    }
-
-    return result[:size]
-}
-
-func (editor *Mp3TagEditor) makeIdv23TagHeader(size int) []byte {
-    header := make([]byte, id3v2HeaderSize)
-    header[0] = 0x49 // I
-    header[1] = 0x44 // D
-    header[2] = 0x33 // 3
-    header[3] = 0x03
-    header[4] = 0x00
-    header[5] = 0x00
-    editor.writeSyncInt32Be(size, header[6:id3v2HeaderSize])
-    return header
-}
-
-var genreCodeToString = map[int]string {
-    0: "Blues", 1: "Classic Rock", 2: "Country", 3: "Dance", 4: "Disco", 5: "Funk",
-    6: "Grunge", 7: "Hip-Hop", 8: "Jazz", 9: "Metal", 10: "New Age",
-    11: "Oldies", 12: "Other", 13: "Pop", 14: "R&B", 15: "Rap",
-    16: "Reggae", 17: "Rock", 18: "Techno", 19: "Industrial", 20: "Alternative",
-    21: "Ska", 22: "Death Metal", 23: "Pranks", 24: "Soundtrack", 25: "Euro-Techno",
-    26: "Ambient", 27: "Trip-Hop", 28: "Vocal", 29: "Jazz+Funk", 30: "Fusion",
-    31: "Trance", 32: "Classical", 33: "Instrumental", 34: "Acid", 35: "House",
-    36: "Game", 37: "Sound Clip", 38: "Gospel", 39: "Noise", 40: "AlternRock",
-    41: "Bass", 42: "Soul", 43: "Punk", 44: "Space", 45: "Meditative",
-    46: "Instrumental Pop", 47: "Instrumental Rock", 48: "Ethnic", 49: "Gothic", 50: "Darkwave",
-    51: "Techno-Industrial", 52: "Electronic", 53: "Pop-Folk", 54: "Eurodance", 55: "Dream",
-    56: "Southern Rock", 57: "Comedy", 58: "Cult", 59: "Gangsta", 60: "Top 40",
-    61: "Christian Rap", 62: "Pop/Funk", 63: "Jungle", 64: "Native American", 65: "Cabaret",
-    66: "New Wave", 67: "Psychadelic", 68: "Rave", 69: "Showtunes", 70: "Trailer",
-    71: "Lo-Fi", 72: "Tribal", 73: "Acid Punk", 74: "Acid Jazz", 75: "Polka",
-    76: "Retro", 77: "Musical", 78: "Rock & Roll", 79: "Hard Rock", 80: "Folk",
-    81: "Folk-Rock", 82: "National Folk", 83: "Swing", 84: "Fast Fusion", 85: "Bebob",
-    86: "Latin", 87: "Revival", 88: "Celtic", 89: "Bluegrass", 90: "Avantgarde",
-    91: "Gothic Rock", 92: "Progressive Rock", 93: "Psychedelic Rock", 94: "Symphonic Rock", 95: "Slow Rock",
-    96: "Big Band", 97: "Chorus", 98: "Easy Listening", 99: "Acoustic", 100: "Humour",
-    101: "Speech", 102: "Chanson", 103: "Opera", 104: "Chamber Music", 105: "Sonata",
-    106: "Symphony", 107: "Booty Brass", 108: "Primus", 109: "Porn Groove", 110: "Satire",
-    111: "Slow Jam", 112: "Club", 113: "Tango", 114: "Samba", 115: "Folklore",
-    116: "Ballad", 117: "Poweer Ballad", 118: "Rhytmic Soul", 119: "Freestyle", 120: "Duet",
-    121: "Punk Rock", 122: "Drum Solo", 123: "A Capela", 124: "Euro-House", 125: "Dance Hall",
-    126: "Unknown", 127: "Unknown",
-}
@@ -0,0 +1,116 @@
+package editor
+
+import (
+    "bytes"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestParseID3v2Frames(t *testing.T) {
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    tests := []struct {
+        name string
+        version int
+        frames []id3v2Frame
+        expected Tag
+    }{
+        {"repeated user text", 3, []id3v2Frame{
+            editor.makeID3v2UserTextFrame(3, "MOOD", "Calm"),
+            editor.makeID3v2UserTextFrame(3, "mood", "Dark"),
+        }, Tag{Custom: map[string]string{"MOOD": "Calm; Dark"}}},
+        {"user text values", 4, []id3v2Frame{
+            {id: "TXXX", data: []byte("\x03MOOD\x00Calm\x00Dark")},
+        }, Tag{Custom: map[string]string{"MOOD": "Calm; Dark"}}},
+        {"user text without description", 4, []id3v2Frame{
+            {id: "TXXX", data: []byte("\x03\x00Calm")},
+        }, Tag{}},
+        {"date", 3, []id3v2Frame{
+            editor.makeID3v2TextFrame("TYER", 3, "1999"),
+            editor.makeID3v2TextFrame("TDAT", 3, "3112"),
+        }, Tag{Date: Date{Year: 1999, Month: 12, Day: 31}}},
+        {"date out of range", 3, []id3v2Frame{
+            editor.makeID3v2TextFrame("TYER", 3, "1999"),
+            editor.makeID3v2TextFrame("TDAT", 3, "3213"),
+        }, Tag{Date: Date{Year: 1999}}},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            tag := editor.parseID3v2Tag(test.frames, test.version)
+            if tag.String() != test.expected.String() || tag.Date != test.expected.Date {
+                t.Errorf("wrong tag:\n%v\nexpected:\n%v", tag, test.expected)
+            }
+        })
+    }
+}
+
+func TestMp3UpdateExistingTags(t *testing.T) {
+    id3v1 := (&Mp3TagEditor{options: DefaultOptions()}).serializeID3v1Tag(Tag{Title: "original"})
+    tests := []struct {
+        name string
+        data []byte
+        ape bool
+        id3v1 bool
+    }{
+        {"no tags", makeTestMp3(), false, false},
+        {"ID3v1 tag", append(makeTestMp3(), id3v1 ...), false, true},
+    }
+
+    options := DefaultOptions()
+    options.ApePolicy = UpdateExistingTag
+    options.ID3v1Policy = UpdateExistingTag
+    editor := NewEditor(Mp3, options)
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "test.mp3")
+            if err := ioutil.WriteFile(path, test.data, 0644); err != nil {
+                t.Fatal(err)
+            }
+            writeTestTag(t, editor, path, Tag{Title: "Title"})
+
+            data, err := ioutil.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if ape := bytes.Contains(data, []byte(apeTagMagic)); ape != test.ape {
+                t.Errorf("APEv2 tag is written: %v, expected: %v", ape, test.ape)
+            }
+            id3v1 := bytes.HasSuffix(data, (&Mp3TagEditor{options: options}).serializeID3v1Tag(Tag{Title: "Title"}))
+            if id3v1 != test.id3v1 {
+                t.Errorf("ID3v1 tag is updated: %v, expected: %v", id3v1, test.id3v1)
+            }
+        })
+    }
+}
+
+func TestMp3PropertiesFalseSync(t *testing.T) {
+    // MPEG-1 Layer III, 128 kbit/s, 44100 Hz, 417 bytes frames
+    frame := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 413) ...)
+    junk := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 96) ...)
+    editor := &Mp3TagEditor{options: DefaultOptions()}
+    data := append(editor.makeNewID3v2TagData(nil, nil, Tag{Title: "Title"}, 0), junk ...)
+    for i := 0; i < 3; i++ {
+        data = append(data, frame ...)
+    }
+
+    path := filepath.Join(t.TempDir(), "test.mp3")
+    if err := ioutil.WriteFile(path, data, 0644); err != nil {
+        t.Fatal(err)
+    }
+    properties, err := editor.ReadProperties(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if expected := time.Duration(3 * len(frame) * 8) * time.Millisecond / 128; properties.Duration != expected {
+        t.Errorf("duration %v, expected %v", properties.Duration, expected)
+    }
+}
+
+func TestSamplesDuration(t *testing.T) {
+    // 20 hours at 192 kHz
+    if duration := samplesDuration(20 * 3600 * 192000 + 96000, 192000); duration != 20 * time.Hour + 500 * time.Millisecond {
+        t.Errorf("duration %v", duration)
+    }
+}
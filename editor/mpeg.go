@@ -0,0 +1,93 @@
+package editor
+
+const (
+    // the 1st MPEG frame is searched in this number of bytes after ID3v2 tags
+    mpegSearchSize int = 64 * 1024
+)
+
+type mpegFrameHeader struct {
+    // 1 for MPEG-1, 2 for MPEG-2 and MPEG-2.5
+    version int
+    layer int
+    // kbit/s
+    bitrate int
+    sampleRate int
+    channels int
+    samplesPerFrame int
+    frameSize int
+    sideInfoSize int
+}
+
+var mpegBitrates = map[int][15]int {
+    11: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+    12: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+    13: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+    21: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+    22: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+    23: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mpegSampleRates = [3]int {44100, 48000, 32000}
+
+// parseMpegFrameHeader parses 4 bytes of frame header, reserved values and free format bitrate are not accepted
+func parseMpegFrameHeader(data []byte) (mpegFrameHeader, bool) {
+    var header mpegFrameHeader
+    if len(data) < 4 || data[0] != 0xFF || data[1] & 0xE0 != 0xE0 {
+        return header, false
+    }
+
+    versionBits := (data[1] >> 3) & 0x03
+    layerBits := (data[1] >> 1) & 0x03
+    bitrateIndex := int(data[2] >> 4)
+    sampleRateIndex := int(data[2] >> 2) & 0x03
+    if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+        return header, false
+    }
+
+    header.version = 2
+    if versionBits == 3 {
+        header.version = 1
+    }
+    header.layer = 4 - int(layerBits)
+    header.bitrate = mpegBitrates[header.version * 10 + header.layer][bitrateIndex]
+
+    header.sampleRate = mpegSampleRates[sampleRateIndex]
+    switch versionBits {
+    case 2:
+        header.sampleRate /= 2
+    case 0:
+        // MPEG-2.5
+        header.sampleRate /= 4
+    }
+
+    header.channels = 2
+    if data[3] >> 6 == 3 {
+        header.channels = 1
+    }
+
+    padding := int(data[2] >> 1) & 0x01
+    switch {
+    case header.layer == 1:
+        header.samplesPerFrame = 384
+        header.frameSize = (12 * header.bitrate * 1000 / header.sampleRate + padding) * 4
+    case header.layer == 3 && header.version == 2:
+        header.samplesPerFrame = 576
+        header.frameSize = 72 * header.bitrate * 1000 / header.sampleRate + padding
+    default:
+        header.samplesPerFrame = 1152
+        header.frameSize = 144 * header.bitrate * 1000 / header.sampleRate + padding
+    }
+
+    switch {
+    case header.version == 1 && header.channels == 1:
+        header.sideInfoSize = 17
+    case header.version == 1:
+        header.sideInfoSize = 32
+    case header.channels == 1:
+        header.sideInfoSize = 9
+    default:
+        header.sideInfoSize = 17
+    }
+
+    return header, true
+}
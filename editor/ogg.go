@@ -2,7 +2,8 @@ package editor
 
 import (
     "bytes"
-    "io/ioutil"
+    "errors"
+    "io"
 
     "github.com/mzinin/tagger/utils"
 )
@@ -10,22 +11,44 @@ import (
 const (
     oggPageMagic string = "OggS"
     oggPageHeaderSize int = 27
-    oggHeaderMagic = "vorbis"
     headerTypeContinue byte = 1
     maxFrameDataSize int = 65025 // 65307 - 282
+    maxPageSize int = 65307
+    opusSampleRate int = 48000
 )
 
+type oggCodec struct {
+    name string
+    idMagic string
+    commentMagic string
+    framingBit bool
+    setupHeader bool
+}
+
+var oggCodecs = []oggCodec {
+    {name: "vorbis", idMagic: "\x01vorbis", commentMagic: "\x03vorbis", framingBit: true, setupHeader: true},
+    {name: "opus", idMagic: "OpusHead", commentMagic: "OpusTags", framingBit: false, setupHeader: false},
+}
+
 type OggTagEditor struct {
-    file []byte
+    codec oggCodec
+    options Options
 }
 
 func (editor *OggTagEditor) ReadTag(path string) (Tag, error) {
-    err := editor.readFile(path)
+    file, size, err := openFile(path)
     if err != nil {
         return Tag{}, err
     }
+    defer file.Close()
 
-    _, commentPages, _ := editor.splitFileData(editor.file)
+    idPage, commentPages, _, err := editor.splitFile(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
+    if err = editor.detectCodec(idPage); err != nil {
+        return Tag{}, err
+    }
     if len(commentPages) == 0 {
         return Tag{}, nil
     }
@@ -33,62 +56,224 @@ func (editor *OggTagEditor) ReadTag(path string) (Tag, error) {
     _, tagData, _ := editor.splitCommentPages(commentPages)
 
     var tag Tag
-    return tag, parseVorbisTags(tagData, &tag)
+    err = parseVorbisTags(tagData, &tag)
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+    return tag, err
+}
+
+// ReadProperties parses identification header, duration is taken from granule position of the last page
+func (editor *OggTagEditor) ReadProperties(path string) (Properties, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Properties{}, err
+    }
+    defer file.Close()
+
+    idPage, _, restOffset, err := editor.splitFile(file, size)
+    if err != nil {
+        return Properties{}, err
+    }
+    if err = editor.detectCodec(idPage); err != nil {
+        return Properties{}, err
+    }
+
+    packets := editor.readPackets(idPage)
+    granule, err := editor.lastGranulePosition(file, size, utils.ReadInt32Le(idPage[14:18]))
+    if err != nil {
+        return Properties{}, err
+    }
+
+    var properties Properties
+    packet := packets[0]
+    switch editor.codec.name {
+    case "vorbis":
+        if len(packet) < 28 {
+            return Properties{}, errors.New("vorbis identification header is too short")
+        }
+        properties.Codec = "Vorbis"
+        properties.Channels = int(packet[11])
+        properties.SampleRate = utils.ReadInt32Le(packet[12:16])
+        properties.Duration = samplesDuration(granule, properties.SampleRate)
+    case "opus":
+        if len(packet) < 19 {
+            return Properties{}, errors.New("opus identification header is too short")
+        }
+        // granule position counts 48 kHz samples including pre-skip ones
+        properties.Codec = "Opus"
+        properties.Channels = int(packet[9])
+        properties.SampleRate = opusSampleRate
+        properties.Duration = samplesDuration(granule - int64(utils.ReadInt16Le(packet[10:12])), opusSampleRate)
+    }
+    properties.Bitrate = averageBitrate(size - restOffset, properties.Duration)
+
+    return properties, nil
+}
+
+// lastGranulePosition finds the last page of the bitstream with a finished packet and returns its granule position
+func (editor *OggTagEditor) lastGranulePosition(file io.ReaderAt, size int64, bitstream int) (int64, error) {
+    offset := size - int64(2 * maxPageSize)
+    if offset < 0 {
+        offset = 0
+    }
+    data, err := readAt(file, offset, int(size - offset))
+    if err != nil {
+        return 0, err
+    }
+
+    for position := bytes.LastIndex(data, []byte(oggPageMagic)); position >= 0; position = bytes.LastIndex(data[:position], []byte(oggPageMagic)) {
+        page := data[position:]
+        pageSize := editor.getPageSize(page)
+        if pageSize == 0 || pageSize > len(page) || utils.ReadInt32Le(page[14:18]) != bitstream {
+            continue
+        }
+        // -1 means no packet is finished on the page
+        if granule := utils.ReadInt64Le(page[6:14]); granule != -1 {
+            return granule, nil
+        }
+    }
+    return 0, errors.New("no ogg page with granule position")
 }
 
 func (editor *OggTagEditor) WriteTag(src, dst string, tag Tag) error {
-    err := editor.readFile(src)
+    tag.Genre = editor.options.Genres.Normalize(tag.Genre)
+    return editor.writePages(src, dst, func(commentPages []byte, padding int) ([]byte, int) {
+        return editor.makeNewPages(commentPages, tag, padding)
+    })
+}
+
+// RemoveTag leaves comment header with vendor string only, the header itself is mandatory
+func (editor *OggTagEditor) RemoveTag(src, dst string) error {
+    return editor.writePages(src, dst, func(commentPages []byte, padding int) ([]byte, int) {
+        return editor.makeCommentPages(commentPages, nil, 0, padding)
+    })
+}
+
+// writePages replaces comment and setup pages with ones made from the existing pages and padding size
+func (editor *OggTagEditor) writePages(src, dst string, makePages func(commentPages []byte, padding int) ([]byte, int)) error {
+    file, size, err := openFile(src)
     if err != nil {
         return err
     }
+    defer file.Close()
 
-    idPage, commentPages, restData := editor.splitFileData(editor.file)
-    newCommentPages, newSetupPages, numberOfPages := editor.makeNewPages(commentPages, tag)
-
-    newPrefix := make([]byte, len(idPage) + len(newCommentPages) + len(newSetupPages))
-    copy(newPrefix, idPage)
-    copy(newPrefix[len(idPage):], newCommentPages)
-    copy(newPrefix[len(idPage) + len(newCommentPages):], newSetupPages)
+    idPage, commentPages, restOffset, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+    if err = editor.detectCodec(idPage); err != nil {
+        return err
+    }
+    // overwrite only header pages if the new ones can be padded to the same size and number of pages
+    if editor.options.InPlace && isSameFile(file, dst) {
+        if newPages, ok := editor.fitNewPages(commentPages, makePages); ok {
+            return writeAt(dst, fileRegion{int64(len(idPage)), newPages})
+        }
+    }
 
-    // fix page numbers and CRCs
-    sequence := numberOfPages + 1
-    data := restData
-    for len(data) > oggPageHeaderSize {
-        pageSize := editor.getPageSize(data)
+    newPages, numberOfPages := makePages(commentPages, editor.options.Padding)
 
-        utils.WriteInt32Le(sequence, data[18:22]) // number
-        utils.WriteUint32Le(0, data[22:26]) // zero CRC
-        utils.WriteUint32Le(editor.crc(data[:pageSize]), data[22:26]) // CRC
+    builder := newFileBuilder(file)
+    builder.appendData(idPage, newPages)
 
-        sequence++
-        data = data[pageSize:]
+    // page numbers and CRCs of the rest pages are fixed only if number of header pages is changed
+    if numberOfPages == editor.countPages(commentPages) {
+        builder.appendRange(restOffset, size - restOffset)
+    } else {
+        rest := &oggPageRenumberer{
+            editor: editor,
+            source: io.NewSectionReader(file, restOffset, size - restOffset),
+            sequence: numberOfPages + 1,
+        }
+        builder.appendReader(rest, size - restOffset)
     }
 
-    return ioutil.WriteFile(dst, append(newPrefix, restData ...), 0666)
+    return builder.save(dst)
 }
 
-func (editor *OggTagEditor) readFile(path string) error {
-    var err error
-    editor.file, err = ioutil.ReadFile(path)
-    return err
+// fitNewPages makes header pages of exactly the same size and number of pages as the existing ones
+func (editor *OggTagEditor) fitNewPages(commentPages []byte, makePages func([]byte, int) ([]byte, int)) ([]byte, bool) {
+    numberOfPages := editor.countPages(commentPages)
+    padding := 0
+
+    // adding padding may grow lacing values as well, so the padding is adjusted a few times
+    for i := 0; i < 32 && padding >= 0; i++ {
+        newPages, newNumberOfPages := makePages(commentPages, padding)
+        diff := len(commentPages) - len(newPages)
+        if diff == 0 {
+            return newPages, newNumberOfPages == numberOfPages
+        }
+        padding += diff
+    }
+    return nil, false
+}
+
+func (editor *OggTagEditor) detectCodec(idPage []byte) error {
+    if len(idPage) > oggPageHeaderSize {
+        packet := idPage[oggPageHeaderSize + int(idPage[oggPageHeaderSize - 1]):]
+        for _, codec := range oggCodecs {
+            if len(packet) >= len(codec.idMagic) && string(packet[:len(codec.idMagic)]) == codec.idMagic {
+                editor.codec = codec
+                return nil
+            }
+        }
+    }
+    return errors.New("unsupported ogg codec")
 }
 
-func (editor *OggTagEditor) splitFileData(data []byte) ([]byte, []byte, []byte) {
-    firstPageSize := editor.getPageSize(data)
-    secondPageSize := editor.getPageSize(data[firstPageSize:])
+// splitFile reads identification and comment pages and returns them with position of the rest pages
+func (editor *OggTagEditor) splitFile(file io.ReaderAt, size int64) ([]byte, []byte, int64, error) {
+    var groups [2][]byte
+    position := int64(0)
 
-    for secondPageSize >= oggPageHeaderSize && data[firstPageSize + 5] & headerTypeContinue != 0 {
-        firstPageSize += secondPageSize
-        secondPageSize = editor.getPageSize(data[firstPageSize:])
+    for i := range groups {
+        for {
+            page, err := editor.readPage(file, position, size)
+            if err != nil {
+                return nil, nil, 0, err
+            }
+            // a packet group ends before the next page not continuing it
+            if page == nil || len(groups[i]) != 0 && page[5] & headerTypeContinue == 0 {
+                break
+            }
+            groups[i] = append(groups[i], page ...)
+            position += int64(len(page))
+        }
+    }
+
+    if len(groups[0]) == 0 {
+        return nil, nil, 0, errors.New("file is not an ogg file")
+    }
+    return groups[0], groups[1], position, nil
+}
+
+// readPage reads the page at position, nil is returned at the end of file or if there is no page
+func (editor *OggTagEditor) readPage(file io.ReaderAt, position, size int64) ([]byte, error) {
+    if size - position < int64(oggPageHeaderSize) {
+        return nil, nil
+    }
+    header, err := readAt(file, position, oggPageHeaderSize)
+    if err != nil || string(header[0:4]) != oggPageMagic {
+        return nil, err
+    }
+    segments, err := readAt(file, position + int64(oggPageHeaderSize), int(header[oggPageHeaderSize - 1]))
+    if err != nil {
+        return nil, err
     }
 
-    thirdPageSize := editor.getPageSize(data[firstPageSize + secondPageSize:])
-    for thirdPageSize >= oggPageHeaderSize && data[firstPageSize + secondPageSize + 5] & headerTypeContinue != 0 {
-        secondPageSize += thirdPageSize
-        thirdPageSize = editor.getPageSize(data[firstPageSize + secondPageSize:])
+    pageSize := editor.getPageSize(append(header, segments ...))
+    if position + int64(pageSize) > size {
+        return nil, errors.New("ogg page is truncated")
     }
+    return readAt(file, position, pageSize)
+}
 
-    return data[:firstPageSize], data[firstPageSize : firstPageSize + secondPageSize], data[firstPageSize + secondPageSize:]
+func (editor *OggTagEditor) countPages(pages []byte) int {
+    result := 0
+    for pageSize := editor.getPageSize(pages); pageSize != 0; pageSize = editor.getPageSize(pages) {
+        pages = pages[pageSize:]
+        result++
+    }
+    return result
 }
 
 func (editor *OggTagEditor) getPageSize(page []byte) int {
@@ -114,104 +299,163 @@ func (editor *OggTagEditor) getPageSize(page []byte) int {
 }
 
 func (editor *OggTagEditor) splitCommentPages(pages []byte) ([]byte, []byte, []byte) {
-    var commentHeader []byte = nil
-    var tagData []byte = nil
+    packets := editor.readPackets(pages)
+    if len(packets) == 0 {
+        return nil, nil, nil
+    }
+
+    commentPacket := packets[0]
+    magicSize := len(editor.codec.commentMagic)
+    if len(commentPacket) < magicSize + 4 {
+        return nil, nil, nil
+    }
+    vendorSize := utils.ReadInt32Le(commentPacket[magicSize : magicSize + 4])
+    if vendorSize < 0 || len(commentPacket) < magicSize + 4 + vendorSize {
+        return nil, nil, nil
+    }
+    commentHeader := commentPacket[:magicSize + 4 + vendorSize]
+
+    // the rest of comment packet after the fields is framing bit and padding
+    tagData := commentPacket[len(commentHeader):]
+    tagData = tagData[:editor.getTagDataSize(tagData)]
+
     var setupHeader []byte = nil
+    if editor.codec.setupHeader && len(packets) > 1 {
+        setupHeader = packets[1]
+    }
 
-    for len(pages) > oggPageHeaderSize {
-        pageHeaderSize := oggPageHeaderSize + int(pages[oggPageHeaderSize - 1])
+    return commentHeader, tagData, setupHeader
+}
 
-        // it's the 1st page, the one with comment header
-        if pages[5] & headerTypeContinue == 0 {
-            if len(pages) < pageHeaderSize + 5 + len(oggHeaderMagic) {
-                return nil, nil, nil
+// readPackets joins segments of the pages into packets, the last packet may be incomplete
+func (editor *OggTagEditor) readPackets(pages []byte) [][]byte {
+    var packets [][]byte = nil
+    var packet []byte = nil
+
+    for pageSize := editor.getPageSize(pages); pageSize != 0; pageSize = editor.getPageSize(pages) {
+        headerSize := oggPageHeaderSize + int(pages[oggPageHeaderSize - 1])
+        data := pages[headerSize : pageSize]
+        for _, segmentSize := range pages[oggPageHeaderSize : headerSize] {
+            packet = append(packet, data[:segmentSize] ...)
+            data = data[segmentSize:]
+            if segmentSize < 255 {
+                packets = append(packets, packet)
+                packet = nil
             }
-            commentHeaderSize := utils.ReadInt32Le(pages[pageHeaderSize + 1 + len(oggHeaderMagic) : pageHeaderSize + 5 + len(oggHeaderMagic)])
-            if len(pages) < pageHeaderSize + 5 + len(oggHeaderMagic) + commentHeaderSize {
-                return nil, nil, nil
-            }
-            commentHeader = pages[pageHeaderSize : pageHeaderSize + 5 + len(oggHeaderMagic) + commentHeaderSize]
-            pageHeaderSize += 5 + len(oggHeaderMagic) + commentHeaderSize
         }
-
-        pageSize := editor.getPageSize(pages)
-        tagData = append(tagData, pages[pageHeaderSize : pageSize] ...)
         pages = pages[pageSize:]
     }
 
-    pos := bytes.Index(tagData, []byte(oggHeaderMagic))
-    if pos != -1 {
-        setupHeader = tagData[pos - 1:]
-        tagData = tagData[:pos - 1]
+    if len(packet) != 0 {
+        packets = append(packets, packet)
     }
+    return packets
+}
 
-    return commentHeader, tagData, setupHeader
+func (editor *OggTagEditor) getTagDataSize(data []byte) int {
+    if len(data) < 4 {
+        return len(data)
+    }
+
+    numberOfFields := utils.ReadInt32Le(data[0:4])
+    size := 4
+    for i := 0; i < numberOfFields && len(data) >= size + 4; i++ {
+        fieldSize := utils.ReadInt32Le(data[size : size + 4])
+        if len(data) < size + 4 + fieldSize {
+            break
+        }
+        size += 4 + fieldSize
+    }
+    return size
+}
+
+func (editor *OggTagEditor) makeNewPages(existingCommentPages []byte, tag Tag, padding int) ([]byte, int) {
+    _, existingTagData, _ := editor.splitCommentPages(existingCommentPages)
+    unsupportedTagData, unsupportedFields, tag := getUnsupportedVorbisTags(existingTagData, tag)
+    newTagData, totalFields := serializeVorbisTag(tag, unsupportedFields)
+
+    return editor.makeCommentPages(existingCommentPages, append(newTagData, unsupportedTagData ...), totalFields, padding)
 }
 
-func (editor *OggTagEditor) makeNewPages(existingCommentPages []byte, tag Tag) ([]byte, []byte, int) {
+// makeCommentPages makes comment packet with the fields keeping vendor string, and packs it with setup header
+func (editor *OggTagEditor) makeCommentPages(existingCommentPages, fields []byte, numberOfFields, padding int) ([]byte, int) {
     // bitstream number
     var bitstream int = 31013
     if len(existingCommentPages) > oggPageHeaderSize {
         bitstream = utils.ReadInt32Le(existingCommentPages[14 : 18])
     }
 
-    commentHeader, existingTagData, setupHeader := editor.splitCommentPages(existingCommentPages)
+    commentHeader, _, setupHeader := editor.splitCommentPages(existingCommentPages)
     if len(commentHeader) == 0 {
-        commentHeader = make([]byte, 1 + len(oggHeaderMagic) + 4)
-        commentHeader[0] = 3
-        copy(commentHeader[1 : 1 + len(oggHeaderMagic)], oggHeaderMagic)
-        utils.WriteInt32Le(0, commentHeader[len(oggHeaderMagic) : len(oggHeaderMagic) + 4])
+        commentHeader = make([]byte, len(editor.codec.commentMagic) + 4)
+        copy(commentHeader, editor.codec.commentMagic)
     }
 
-    unsupportedTagData, unsupportedFields := getUnsupportedVorbisTags(existingTagData)
-    newTagData, totalFields := serializeVorbisTag(tag, unsupportedFields)
+    framingBitSize := 0
+    if editor.codec.framingBit {
+        framingBitSize = 1
+    }
 
-    tagData := make([]byte, len(commentHeader) + 4 + len(newTagData) + len(unsupportedTagData) + 1)
+    // padding zeros follow the framing bit or the last field
+    tagData := make([]byte, len(commentHeader) + 4 + len(fields) + framingBitSize + padding)
     copy(tagData, commentHeader)
-    utils.WriteInt32Le(totalFields, tagData[len(commentHeader) : len(commentHeader) + 4])
-    copy(tagData[len(commentHeader) + 4:], newTagData)
-    copy(tagData[len(commentHeader) + 4 + len(newTagData):], unsupportedTagData)
-    tagData[len(tagData) - 1] = 1
-
-    newCommentHeader, commentPages := editor.packTagDataIntoFrames(bitstream, 1, tagData)
-    newSetupHeader, setupPages := editor.packTagDataIntoFrames(bitstream, commentPages + 1, setupHeader)
+    utils.WriteInt32Le(numberOfFields, tagData[len(commentHeader) : len(commentHeader) + 4])
+    copy(tagData[len(commentHeader) + 4:], fields)
+    if editor.codec.framingBit {
+        tagData[len(tagData) - padding - 1] = 1
+    }
 
-    return newCommentHeader, newSetupHeader, commentPages + setupPages
+    return editor.packTagDataIntoFrames(bitstream, 1, tagData, setupHeader)
 }
 
-func (editor *OggTagEditor) packTagDataIntoFrames(bitstream, sequence int, tagData []byte) ([]byte, int) {
-    totalTagSize := len(tagData)
-    if totalTagSize == 0 {
-        return nil, 0
+// packTagDataIntoFrames lays packets out into pages, a packet may span several pages
+// and a page may hold several packets
+func (editor *OggTagEditor) packTagDataIntoFrames(bitstream, sequence int, packets ...[]byte) ([]byte, int) {
+    // every packet ends with a lacing value less than 255, even a zero one
+    var lacingValues []byte = nil
+    var data []byte = nil
+    for _, packet := range packets {
+        if len(packet) == 0 {
+            continue
+        }
+        lacingValues = append(lacingValues, bytes.Repeat([]byte{0xFF}, len(packet) / 255) ...)
+        lacingValues = append(lacingValues, byte(len(packet) % 255))
+        data = append(data, packet ...)
     }
 
-    tagSize := 0
-    size := 0
+    result := make([]byte, 0, len(data) + len(lacingValues) + oggPageHeaderSize * (len(lacingValues) / 255 + 1))
     pages := 0
+    continued := false
 
-    result := make([]byte, totalTagSize + 282 * (totalTagSize / maxFrameDataSize + 1))
-
-    for tagSize < totalTagSize {
-        headerSize, dataSize := editor.fillHeader(result[size:], bitstream, sequence + pages, totalTagSize - tagSize)
-        pages++
-        if tagSize != 0 {
-            result[size + len(oggPageMagic) + 1] = headerTypeContinue
+    for len(lacingValues) != 0 {
+        segments := 255
+        if len(lacingValues) < segments {
+            segments = len(lacingValues)
+        }
+        dataSize := 0
+        for _, value := range lacingValues[:segments] {
+            dataSize += int(value)
         }
-        size += headerSize
 
-        copy(result[size : size + dataSize], tagData[:dataSize])
-        size += dataSize
-        tagSize += dataSize
-        tagData = tagData[dataSize:]
+        page := make([]byte, oggPageHeaderSize + segments + dataSize)
+        editor.fillHeader(page, bitstream, sequence + pages, lacingValues[:segments])
+        if continued {
+            page[len(oggPageMagic) + 1] = headerTypeContinue
+        }
+        continued = lacingValues[segments - 1] == 0xFF
+        copy(page[oggPageHeaderSize + segments:], data[:dataSize])
+        utils.WriteUint32Le(editor.crc(page), page[22:26])
 
-        checksum := editor.crc(result[size - headerSize - dataSize : size])
-        utils.WriteUint32Le(checksum, result[size - headerSize - dataSize + 22 : size - headerSize - dataSize + 26])
+        result = append(result, page ...)
+        pages++
+        lacingValues = lacingValues[segments:]
+        data = data[dataSize:]
     }
 
-    return result[:size], pages
+    return result, pages
 }
 
-func (editor *OggTagEditor) fillHeader(dst []byte, bitstream, sequence, totalSize int) (int, int) {
+func (editor *OggTagEditor) fillHeader(dst []byte, bitstream, sequence int, lacingValues []byte) {
     copy(dst[0:4], oggPageMagic) // magic
     dst[4] = 0 // version
     dst[5] = 0 // header type
@@ -229,34 +473,71 @@ func (editor *OggTagEditor) fillHeader(dst []byte, bitstream, sequence, totalSiz
     dst[23] = 0
     dst[24] = 0
     dst[25] = 0
+    dst[26] = byte(len(lacingValues)) // number of segments
+    copy(dst[27:], lacingValues)
+}
 
-    dataSize := totalSize
-    if dataSize > maxFrameDataSize {
-        dataSize = maxFrameDataSize
+func (editor *OggTagEditor) crc(data []byte) uint32 {
+    var crc uint32 = 0
+    for i := range data {
+        crc = oggCrcTable[byte(crc>>24) ^ data[i]] ^ (crc << 8)
     }
+    return crc
+}
 
-    dst[26] = byte(dataSize / 255)
-    if dataSize % 255 != 0 {
-        dst[26]++
-    }
+// oggPageRenumberer reads pages from source and fixes their sequence numbers and CRCs on the fly
+type oggPageRenumberer struct {
+    editor *OggTagEditor
+    source io.Reader
+    sequence int
+    page []byte
+}
 
-    headerSize := 27 + int(dst[26])
-    for i := 27; i < headerSize; i++ {
-        dst[i] = 0xFF
-    }
-    if dataSize % 255 != 0 {
-        dst[headerSize - 1] = byte(dataSize % 255)
+func (renumberer *oggPageRenumberer) Read(dst []byte) (int, error) {
+    if len(renumberer.page) == 0 {
+        if err := renumberer.readPage(); err != nil {
+            return 0, err
+        }
     }
 
-    return headerSize, dataSize
+    n := copy(dst, renumberer.page)
+    renumberer.page = renumberer.page[n:]
+    return n, nil
 }
 
-func (editor *OggTagEditor) crc(data []byte) uint32 {
-    var crc uint32 = 0
-    for i := range data {
-        crc = oggCrcTable[byte(crc>>24) ^ data[i]] ^ (crc << 8)
+func (renumberer *oggPageRenumberer) readPage() error {
+    header := make([]byte, oggPageHeaderSize, oggPageHeaderSize + 255)
+    n, err := io.ReadFull(renumberer.source, header)
+    if err != nil {
+        if n != 0 {
+            // garbage at the end of file is kept as is
+            renumberer.page = header[:n]
+            return nil
+        }
+        return err
     }
-    return crc
+    if string(header[0:4]) != oggPageMagic {
+        renumberer.page = header
+        return nil
+    }
+
+    header = header[:oggPageHeaderSize + int(header[oggPageHeaderSize - 1])]
+    if _, err = io.ReadFull(renumberer.source, header[oggPageHeaderSize:]); err != nil {
+        return err
+    }
+    page := make([]byte, renumberer.editor.getPageSize(header))
+    copy(page, header)
+    if _, err = io.ReadFull(renumberer.source, page[len(header):]); err != nil {
+        return err
+    }
+
+    utils.WriteInt32Le(renumberer.sequence, page[18:22]) // number
+    utils.WriteUint32Le(0, page[22:26]) // zero CRC
+    utils.WriteUint32Le(renumberer.editor.crc(page), page[22:26]) // CRC
+    renumberer.sequence++
+
+    renumberer.page = page
+    return nil
 }
 
 var oggCrcTable = []uint32 {
@@ -0,0 +1,89 @@
+package editor
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+const (
+    // FLAC PADDING block size is 24-bit
+    maxPadding int = 0xFFFFFF
+)
+
+type TagPolicy int
+
+const (
+    KeepTag TagPolicy = iota
+    UpdateTag
+    StripTag
+    // UpdateExistingTag updates the tag if the file has one, no new tag is added
+    UpdateExistingTag
+)
+
+type Options struct {
+    ApePolicy TagPolicy
+    ID3v1Policy TagPolicy
+    ID3v2Version int
+    // Padding is the number of bytes reserved in ID3v2 tags, FLAC and Ogg comments and M4A free atoms
+    // for future in-place updates
+    Padding int
+    // InPlace allows overwriting only tags of a file if the new ones fit into the existing space, it saves copying
+    // of audio data, but unlike writing a new file and renaming it, a crash during writing may corrupt the file
+    InPlace bool
+    // Charset of 8-bit text in ID3v1 tags and ISO-8859-1 frames of ID3v2 tags, legacy taggers used
+    // the system codepage there, utils.AutoCharset detects it for every text
+    Charset string
+    // Genres normalizes genres of MP3, FLAC, Ogg and M4A files on reading and writing
+    Genres GenreMap
+}
+
+func DefaultOptions() Options {
+    return Options{
+        ApePolicy: KeepTag,
+        ID3v1Policy: StripTag,
+        ID3v2Version: 3,
+        Padding: 1024,
+        Charset: utils.Latin1Charset,
+    }
+}
+
+func StringToTagPolicy(policy string) (TagPolicy, error) {
+    switch strings.ToUpper(policy) {
+    case "KEEP":
+        return KeepTag, nil
+    case "UPDATE":
+        return UpdateTag, nil
+    case "STRIP":
+        return StripTag, nil
+    }
+    return KeepTag, fmt.Errorf("Unknown tag policy '%v'", policy)
+}
+
+func StringToPadding(padding string) (int, error) {
+    result, err := strconv.Atoi(padding)
+    if err != nil || result < 0 || result > maxPadding {
+        return 0, fmt.Errorf("Wrong padding size '%v'", padding)
+    }
+    return result, nil
+}
+
+func StringToCharset(charset string) (string, error) {
+    result, ok := utils.NormalizeCharset(charset)
+    if !ok {
+        return "", fmt.Errorf("Unsupported charset '%v'", charset)
+    }
+    return result, nil
+}
+
+func StringToID3v2Version(version string) (int, error) {
+    switch version {
+    case "3", "2.3":
+        return 3, nil
+    case "4", "2.4":
+        return 4, nil
+    }
+    return 0, fmt.Errorf("Unsupported ID3v2 version '%v'", version)
+}
@@ -0,0 +1,71 @@
+package editor
+
+import (
+    "errors"
+    "strconv"
+    "time"
+)
+
+// Properties describes audio stream of a file
+type Properties struct {
+    Codec string
+    Duration time.Duration
+    // Bitrate is average bitrate in kbit/s
+    Bitrate int
+    SampleRate int
+    Channels int
+    // BitDepth is 0 for lossy codecs
+    BitDepth int
+}
+
+// PropertiesReader is implemented by editors able to read audio properties
+type PropertiesReader interface {
+    ReadProperties(path string) (Properties, error)
+}
+
+func (properties Properties) String() string {
+    return "Codec: " + properties.Codec + "\n" +
+           "Duration: " + properties.Duration.String() + "\n" +
+           "Bitrate: " + strconv.Itoa(properties.Bitrate) + " kbit/s\n" +
+           "Sample Rate: " + strconv.Itoa(properties.SampleRate) + " Hz\n" +
+           "Channels: " + strconv.Itoa(properties.Channels) + "\n" +
+           "Bit Depth: " + strconv.Itoa(properties.BitDepth)
+}
+
+// ReadProperties detects file format by contents and reads its audio properties
+func ReadProperties(path string) (Properties, error) {
+    file, _, err := openFile(path)
+    if err != nil {
+        return Properties{}, err
+    }
+    editor, err := Detect(file)
+    file.Close()
+    if err != nil {
+        return Properties{}, err
+    }
+
+    reader, ok := editor.(PropertiesReader)
+    if !ok {
+        return Properties{}, errors.New("audio properties of the format are not supported")
+    }
+    return reader.ReadProperties(path)
+}
+
+// samplesDuration converts number of samples to duration
+func samplesDuration(samples int64, sampleRate int) time.Duration {
+    if sampleRate <= 0 || samples <= 0 {
+        return 0
+    }
+    // whole seconds first, so long recordings of high sample rate do not overflow
+    seconds := samples / int64(sampleRate)
+    rest := samples % int64(sampleRate)
+    return time.Duration(seconds) * time.Second + time.Duration(rest * int64(time.Second) / int64(sampleRate))
+}
+
+// averageBitrate returns bitrate in kbit/s of the data size played for the duration
+func averageBitrate(size int64, duration time.Duration) int {
+    if duration <= 0 {
+        return 0
+    }
+    return int((size * 8 * int64(time.Millisecond) + int64(duration) / 2) / int64(duration))
+}
@@ -0,0 +1,175 @@
+package editor
+
+import (
+    "io"
+    "os"
+
+    "github.com/mzinin/tagger/utils"
+)
+
+const (
+    riffChunkHeaderSize int = 8
+    riffFormHeaderSize int = 12
+)
+
+type riffChunk struct {
+    id string
+    position int
+    size int
+    // header and payload, nil if the chunk is not loaded from file
+    data []byte
+}
+
+func (chunk riffChunk) payload() []byte {
+    return chunk.data[riffChunkHeaderSize:]
+}
+
+// readRiffChunks splits data into chunks, sizes are little-endian for RIFF and big-endian for IFF (AIFF)
+func readRiffChunks(data []byte, bigEndian bool) []riffChunk {
+    result := make([]riffChunk, 0, 8)
+    position := 0
+
+    for len(data) - position >= riffChunkHeaderSize {
+        size := 0
+        if bigEndian {
+            size = utils.ReadInt32Be(data[position + 4 : position + 8])
+        } else {
+            size = utils.ReadInt32Le(data[position + 4 : position + 8])
+        }
+
+        end := position + riffChunkHeaderSize + size
+        if end > len(data) {
+            // tolerate truncated last chunk
+            end = len(data)
+        }
+
+        result = append(result, riffChunk{
+            id: string(data[position : position + 4]),
+            position: position,
+            size: end - position - riffChunkHeaderSize,
+            data: data[position : end],
+        })
+
+        // chunks are word aligned
+        position = end + (end - position) % 2
+    }
+
+    return result
+}
+
+// readRiffFileChunks reads chunks of RIFF or IFF form in file, only payloads of chunks accepted by load are read
+// data after the form is not read
+func readRiffFileChunks(file io.ReaderAt, fileSize int64, bigEndian bool, load func(id string) bool) ([]riffChunk, error) {
+    formEnd, err := riffFormEnd(file, fileSize, bigEndian)
+    if err != nil {
+        return nil, err
+    }
+    result := make([]riffChunk, 0, 8)
+    position := int64(riffFormHeaderSize)
+
+    for formEnd - position >= int64(riffChunkHeaderSize) {
+        header, err := readAt(file, position, riffChunkHeaderSize)
+        if err != nil {
+            return nil, err
+        }
+
+        size := int64(0)
+        if bigEndian {
+            size = int64(utils.ReadInt32Be(header[4:8]))
+        } else {
+            size = int64(utils.ReadInt32Le(header[4:8]))
+        }
+        if position + int64(riffChunkHeaderSize) + size > formEnd {
+            // tolerate truncated last chunk
+            size = formEnd - position - int64(riffChunkHeaderSize)
+        }
+
+        chunk := riffChunk{id: string(header[0:4]), position: int(position), size: int(size)}
+        if load(chunk.id) {
+            if chunk.data, err = readAt(file, position, riffChunkHeaderSize + int(size)); err != nil {
+                return nil, err
+            }
+        }
+        result = append(result, chunk)
+
+        // chunks are word aligned
+        position += int64(riffChunkHeaderSize) + size + size % 2
+    }
+
+    return result, nil
+}
+
+// riffFormEnd returns end of the form declared by its header, file size is used if the form does not fit into the file
+func riffFormEnd(file io.ReaderAt, fileSize int64, bigEndian bool) (int64, error) {
+    header, err := readAt(file, 0, riffChunkHeaderSize)
+    if err != nil {
+        return 0, err
+    }
+    size := int64(0)
+    if bigEndian {
+        size = int64(utils.ReadInt32Be(header[4:8]))
+    } else {
+        size = int64(utils.ReadInt32Le(header[4:8]))
+    }
+    if end := int64(riffChunkHeaderSize) + size; end >= int64(riffFormHeaderSize) && end <= fileSize {
+        return end, nil
+    }
+    return fileSize, nil
+}
+
+// saveRiffForm saves form of the chunks into dst, data after the form in source file is kept
+func saveRiffForm(file *os.File, fileSize int64, dst, id, formType string, chunks *fileBuilder, bigEndian bool) error {
+    formEnd, err := riffFormEnd(file, fileSize, bigEndian)
+    if err != nil {
+        return err
+    }
+
+    builder := newFileBuilder(file)
+    builder.appendData(makeRiffFormHeader(id, formType, int(chunks.size), bigEndian))
+    builder.appendBuilder(chunks)
+    builder.appendRange(formEnd, fileSize - formEnd)
+    return builder.save(dst)
+}
+
+// appendRiffChunk appends chunk to new file, payload of not loaded chunk is copied from source file
+func appendRiffChunk(builder *fileBuilder, chunk riffChunk, bigEndian bool) {
+    if chunk.data != nil {
+        builder.appendData(makeRiffChunk(chunk.id, chunk.payload(), bigEndian))
+        return
+    }
+
+    builder.appendData(makeRiffChunkHeader(chunk.id, chunk.size, bigEndian))
+    builder.appendRange(int64(chunk.position + riffChunkHeaderSize), int64(chunk.size))
+    if chunk.size % 2 != 0 {
+        builder.appendData([]byte{0})
+    }
+}
+
+func makeRiffChunkHeader(id string, size int, bigEndian bool) []byte {
+    result := make([]byte, riffChunkHeaderSize)
+    copy(result[0:4], id)
+    if bigEndian {
+        utils.WriteInt32Be(size, result[4:8])
+    } else {
+        utils.WriteInt32Le(size, result[4:8])
+    }
+    return result
+}
+
+func makeRiffChunk(id string, payload []byte, bigEndian bool) []byte {
+    result := make([]byte, riffChunkHeaderSize, riffChunkHeaderSize + len(payload) + len(payload) % 2)
+    copy(result, makeRiffChunkHeader(id, len(payload), bigEndian))
+    result = append(result, payload ...)
+    if len(payload) % 2 != 0 {
+        result = append(result, 0)
+    }
+    return result
+}
+
+// makeRiffFormHeader makes form header for chunks of the given total size
+func makeRiffFormHeader(id, formType string, chunksSize int, bigEndian bool) []byte {
+    result := make([]byte, riffFormHeaderSize)
+    copy(result[0:8], makeRiffChunkHeader(id, chunksSize + 4, bigEndian))
+    copy(result[8:12], formType)
+    return result
+}
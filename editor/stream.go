@@ -0,0 +1,184 @@
+package editor
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// openFile opens file for reading and returns it together with its size
+func openFile(path string) (*os.File, int64, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, 0, err
+    }
+
+    return file, info.Size(), nil
+}
+
+// readAt reads exactly size bytes from offset
+func readAt(reader io.ReaderAt, offset int64, size int) ([]byte, error) {
+    data := make([]byte, size)
+    n, err := reader.ReadAt(data, offset)
+    if n == size {
+        return data, nil
+    }
+    if err == nil || err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+    return nil, err
+}
+
+// isSameFile reports whether path refers to the opened source file
+func isSameFile(source *os.File, path string) bool {
+    sourceInfo, err := source.Stat()
+    if err != nil {
+        return false
+    }
+    info, err := os.Stat(path)
+    return err == nil && os.SameFile(sourceInfo, info)
+}
+
+// fileRegion is data to be written at offset of existing file
+type fileRegion struct {
+    offset int64
+    data []byte
+}
+
+// writeAt overwrites regions of existing file without touching the rest of it, modification time is kept,
+// the file is not copied, so it is not crash-safe and is used only if Options.InPlace is set
+func writeAt(path string, regions ...fileRegion) error {
+    info, err := os.Stat(path)
+    if err != nil {
+        return err
+    }
+    file, err := os.OpenFile(path, os.O_WRONLY, 0)
+    if err != nil {
+        return err
+    }
+
+    for _, region := range regions {
+        if _, err = file.WriteAt(region.data, region.offset); err != nil {
+            break
+        }
+    }
+    if err == nil {
+        err = file.Sync()
+    }
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return err
+    }
+    return os.Chtimes(path, time.Now(), info.ModTime())
+}
+
+// fileBuilder collects new file contents from in-memory data and regions of source file,
+// so audio data is copied without being loaded into memory
+type fileBuilder struct {
+    source *os.File
+    parts []io.Reader
+    size int64
+}
+
+func newFileBuilder(source *os.File) *fileBuilder {
+    return &fileBuilder{source: source}
+}
+
+func (builder *fileBuilder) appendData(data ...[]byte) {
+    for _, part := range data {
+        if len(part) != 0 {
+            builder.parts = append(builder.parts, bytes.NewReader(part))
+            builder.size += int64(len(part))
+        }
+    }
+}
+
+func (builder *fileBuilder) appendRange(offset, size int64) {
+    if size > 0 {
+        builder.appendReader(io.NewSectionReader(builder.source, offset, size), size)
+    }
+}
+
+// appendReader appends size bytes produced by reader
+func (builder *fileBuilder) appendReader(reader io.Reader, size int64) {
+    builder.parts = append(builder.parts, reader)
+    builder.size += size
+}
+
+func (builder *fileBuilder) appendBuilder(other *fileBuilder) {
+    builder.parts = append(builder.parts, other.parts ...)
+    builder.size += other.size
+}
+
+// save writes the contents into a temporary file next to path, flushes it to disk and renames it,
+// so path may be the source file itself and is never left truncated,
+// mode and modification time of the source file are kept, the source file is closed before renaming
+func (builder *fileBuilder) save(path string) error {
+    temp, err := ioutil.TempFile(filepath.Dir(path), "." + filepath.Base(path) + ".")
+    if err != nil {
+        return err
+    }
+
+    if _, err = io.Copy(temp, io.MultiReader(builder.parts ...)); err == nil {
+        err = temp.Chmod(builder.fileMode(path))
+    }
+    if err == nil {
+        err = temp.Sync()
+    }
+    if closeErr := temp.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil && builder.source != nil {
+        var info os.FileInfo
+        if info, err = builder.source.Stat(); err == nil {
+            err = os.Chtimes(temp.Name(), time.Now(), info.ModTime())
+        }
+    }
+    if err != nil {
+        os.Remove(temp.Name())
+        return err
+    }
+
+    if builder.source != nil {
+        builder.source.Close()
+    }
+    if err = os.Rename(temp.Name(), path); err != nil {
+        os.Remove(temp.Name())
+        return err
+    }
+    syncDir(filepath.Dir(path))
+    return nil
+}
+
+// fileMode returns mode of existing file, of the source file for a new one or the default mode
+func (builder *fileBuilder) fileMode(path string) os.FileMode {
+    if info, err := os.Stat(path); err == nil {
+        return info.Mode().Perm()
+    }
+    if builder.source != nil {
+        if info, err := builder.source.Stat(); err == nil {
+            return info.Mode().Perm()
+        }
+    }
+    return 0644
+}
+
+// syncDir flushes directory entries to disk, so renaming survives a crash,
+// it is not supported on some platforms, so errors are ignored
+func syncDir(dir string) {
+    if file, err := os.Open(dir); err == nil {
+        file.Sync()
+        file.Close()
+    }
+}
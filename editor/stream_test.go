@@ -0,0 +1,114 @@
+package editor
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestFileBuilder(t *testing.T) {
+    tests := []struct {
+        name string
+        build func(builder *fileBuilder)
+        expected string
+    }{
+        {"data", func(builder *fileBuilder) {
+            builder.appendData([]byte("abc"), nil, []byte("de"))
+        }, "abcde"},
+        {"ranges", func(builder *fileBuilder) {
+            builder.appendRange(2, 3)
+            builder.appendRange(0, 0)
+            builder.appendData([]byte("!"))
+            builder.appendRange(7, 1)
+        }, "cde!h"},
+        {"builders", func(builder *fileBuilder) {
+            other := newFileBuilder(builder.source)
+            other.appendRange(0, 2)
+            builder.appendData([]byte("<"))
+            builder.appendBuilder(other)
+            builder.appendData([]byte(">"))
+        }, "<ab>"},
+    }
+
+    modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+    for _, test := range tests {
+        for _, overwrite := range []bool{false, true} {
+            name := test.name
+            if overwrite {
+                name += "/overwrite"
+            }
+            t.Run(name, func(t *testing.T) {
+                dir := t.TempDir()
+                src := filepath.Join(dir, "src")
+                if err := ioutil.WriteFile(src, []byte("abcdefgh"), 0600); err != nil {
+                    t.Fatal(err)
+                }
+                if err := os.Chtimes(src, modTime, modTime); err != nil {
+                    t.Fatal(err)
+                }
+                dst := filepath.Join(dir, "dst")
+                if overwrite {
+                    dst = src
+                }
+
+                source, _, err := openFile(src)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                defer source.Close()
+                builder := newFileBuilder(source)
+                test.build(builder)
+                if builder.size != int64(len(test.expected)) {
+                    t.Errorf("size %v, expected %v", builder.size, len(test.expected))
+                }
+                if err = builder.save(dst); err != nil {
+                    t.Fatal(err)
+                }
+
+                data, err := ioutil.ReadFile(dst)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if string(data) != test.expected {
+                    t.Errorf("contents '%v', expected '%v'", string(data), test.expected)
+                }
+                info := statTestFile(t, dst)
+                if info.Mode().Perm() != 0600 || !info.ModTime().Equal(modTime) {
+                    t.Errorf("mode %v and modification time %v are not kept", info.Mode(), info.ModTime())
+                }
+                // temporary file is renamed
+                files := 2
+                if overwrite {
+                    files = 1
+                }
+                if entries, _ := ioutil.ReadDir(dir); len(entries) != files {
+                    t.Errorf("%v files in directory, expected %v", len(entries), files)
+                }
+            })
+        }
+    }
+}
+
+func TestWriteAt(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "file")
+    if err := ioutil.WriteFile(path, []byte("abcdefgh"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    before := statTestFile(t, path)
+
+    if err := writeAt(path, fileRegion{0, []byte("AB")}, fileRegion{6, []byte("GH")}); err != nil {
+        t.Fatal(err)
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(data) != "ABcdefGH" {
+        t.Errorf("contents '%v'", string(data))
+    }
+    if after := statTestFile(t, path); !os.SameFile(before, after) || !after.ModTime().Equal(before.ModTime()) {
+        t.Error("file is replaced or its modification time is changed")
+    }
+}
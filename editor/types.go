@@ -2,44 +2,327 @@ package editor
 
 
 import (
-    "math"
+    "sort"
     "strconv"
+    "strings"
 )
 
+// valueSeparator joins several values of Artist, Composer, Performer and Genre fields
+const valueSeparator = "; "
+
 type Tag struct {
     Title string
+    // Artist, Composer, Performer and Genre may hold several values joined by "; "
     Artist string
+    AlbumArtist string
     Album string
     Track int
-    Year int
+    TrackTotal int
+    Disc int
+    DiscTotal int
+    // Date is the release date, OriginalDate is the date of the original release
+    Date Date
+    OriginalDate Date
+    // Comment is the main comment, Comments are other ones, described comments of ID3v2 tags among them
     Comment string
+    Comments []Comment
+    // commentFromDescription is set if the main comment is read from Vorbis DESCRIPTION field
+    commentFromDescription bool
     Genre string
-    Cover Cover
+    Composer string
+    Performer string
+    BPM int
+    ISRC string
+    Label string
+    Compilation bool
+    // Lyrics are unsynchronised lyrics, SyncedLyrics are time-synchronised ones
+    Lyrics string
+    SyncedLyrics []LyricsLine
+    Chapters []Chapter
+    // CueSheet holds logical tracks of album image, track times are stored in FLAC files only
+    CueSheet CueSheet
+    Covers []Cover
+    // Custom holds fields without a dedicated member (TXXX frames, unknown Vorbis comments, etc.),
+    // keys are upper case, a key with empty value removes the field from the file
+    Custom map[string]string
 }
 
 func (tag Tag) String() string {
     return "Title: " + tag.Title + "\n" +
            "Artist: " + tag.Artist + "\n" +
+           "Album Artist: " + tag.AlbumArtist + "\n" +
            "Album: " + tag.Album + "\n" +
            "Track: " + strconv.Itoa(tag.Track) + "\n" +
-           "Year: " + strconv.Itoa(tag.Year) + "\n" +
+           "Track Total: " + strconv.Itoa(tag.TrackTotal) + "\n" +
+           "Disc: " + strconv.Itoa(tag.Disc) + "\n" +
+           "Disc Total: " + strconv.Itoa(tag.DiscTotal) + "\n" +
+           "Date: " + tag.Date.String() + "\n" +
+           "Original Date: " + tag.OriginalDate.String() + "\n" +
            "Comment: " + tag.Comment + "\n" +
+           tag.commentsString() +
            "Genre: " + tag.Genre + "\n" +
-           "Cover: " + tag.Cover.String()
+           "Composer: " + tag.Composer + "\n" +
+           "Performer: " + tag.Performer + "\n" +
+           "BPM: " + strconv.Itoa(tag.BPM) + "\n" +
+           "ISRC: " + tag.ISRC + "\n" +
+           "Label: " + tag.Label + "\n" +
+           "Compilation: " + strconv.FormatBool(tag.Compilation) + "\n" +
+           "Lyrics: " + strconv.Itoa(tag.lyricsLines()) + " lines\n" +
+           "Synced Lyrics: " + strconv.Itoa(len(tag.SyncedLyrics)) + " lines\n" +
+           "Chapters: " + strconv.Itoa(len(tag.Chapters)) + "\n" +
+           "Cue Tracks: " + strconv.Itoa(len(tag.CueSheet.Tracks)) + "\n" +
+           tag.customString() +
+           tag.coversString()
+}
+
+func (tag Tag) commentsString() string {
+    result := ""
+    for _, comment := range tag.Comments {
+        result += "Comment (" + comment.Description + "): " + comment.Text + "\n"
+    }
+    return result
+}
+
+// SplitValues splits field of several values
+func SplitValues(text string) []string {
+    if len(text) == 0 {
+        return nil
+    }
+    return strings.Split(text, valueSeparator)
+}
+
+// JoinValues joins values of a field, empty and duplicate values are skipped
+func JoinValues(values ...string) string {
+    result := make([]string, 0, len(values))
+    for _, value := range values {
+        if value = strings.TrimSpace(value); len(value) == 0 {
+            continue
+        }
+        duplicate := false
+        for _, existing := range result {
+            duplicate = duplicate || existing == value
+        }
+        if !duplicate {
+            result = append(result, value)
+        }
+    }
+    return strings.Join(result, valueSeparator)
+}
+
+// appendValue adds value to field of several values
+func appendValue(field *string, value string) {
+    *field = JoinValues(append(SplitValues(*field), value) ...)
+}
+
+func (tag Tag) lyricsLines() int {
+    if len(tag.Lyrics) == 0 {
+        return 0
+    }
+    return strings.Count(strings.TrimRight(tag.Lyrics, "\n"), "\n") + 1
+}
+
+func (tag Tag) coversString() string {
+    if len(tag.Covers) == 0 {
+        return "Cover: " + Cover{}.String()
+    }
+    result := ""
+    for i, cover := range tag.Covers {
+        if i != 0 {
+            result += "\n"
+        }
+        result += "Cover: " + cover.String()
+    }
+    return result
+}
+
+// Cover returns the front cover, the 1st picture if there is no front cover, or an empty one
+func (tag Tag) Cover() Cover {
+    for _, cover := range tag.Covers {
+        if cover.TypeCode() == frontCoverType {
+            return cover
+        }
+    }
+    if len(tag.Covers) != 0 {
+        return tag.Covers[0]
+    }
+    return Cover{}
+}
+
+// SetCover replaces the picture of the same type or adds a new one
+func (tag *Tag) SetCover(cover Cover) {
+    if cover.Empty() {
+        return
+    }
+    for i := range tag.Covers {
+        if tag.Covers[i].TypeCode() == cover.TypeCode() {
+            tag.Covers[i] = cover
+            return
+        }
+    }
+    tag.Covers = append(tag.Covers, cover)
+}
+
+// RemoveCover removes pictures of the type
+func (tag *Tag) RemoveCover(pictureType string) {
+    code := Cover{Type: pictureType}.TypeCode()
+    covers := tag.Covers[:0]
+    for _, cover := range tag.Covers {
+        if cover.TypeCode() != code {
+            covers = append(covers, cover)
+        }
+    }
+    tag.Covers = covers
+}
+
+func (tag Tag) customString() string {
+    result := ""
+    for _, key := range tag.customKeys() {
+        result += key + ": " + tag.Custom[key] + "\n"
+    }
+    return result
+}
+
+// customKeys returns sorted keys of custom fields, so the fields are always written in the same order
+func (tag Tag) customKeys() []string {
+    keys := make([]string, 0, len(tag.Custom))
+    for key := range tag.Custom {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// withoutCustom returns copy of the tag without the custom fields, the keys are upper case
+func (tag Tag) withoutCustom(keys map[string]bool) Tag {
+    custom := make(map[string]string, len(tag.Custom))
+    for key, value := range tag.Custom {
+        if !keys[key] {
+            custom[key] = value
+        }
+    }
+    tag.Custom = custom
+    return tag
+}
+
+// SetCustom sets custom field, the key is converted to upper case
+func (tag *Tag) SetCustom(key, value string) {
+    if tag.Custom == nil {
+        tag.Custom = make(map[string]string)
+    }
+    tag.Custom[strings.ToUpper(key)] = value
+}
+
+// hasCustom reports whether the custom field is set, even to empty value
+func (tag Tag) hasCustom(key string) bool {
+    _, ok := tag.Custom[strings.ToUpper(key)]
+    return ok
+}
+
+// RemoveField clears the field by name, other names are removed as custom fields, so fields passed through
+// by editors (TXXX descriptions, Vorbis and APE keys, ID3v2 frame ids, M4A atom names) are removed as well
+func (tag *Tag) RemoveField(name string) {
+    switch strings.NewReplacer(" ", "", "_", "").Replace(strings.ToUpper(name)) {
+    case "TITLE":
+        tag.Title = ""
+    case "ARTIST":
+        tag.Artist = ""
+    case "ALBUMARTIST":
+        tag.AlbumArtist = ""
+    case "ALBUM":
+        tag.Album = ""
+    case "TRACK", "TRACKNUMBER":
+        tag.Track = 0
+    case "TRACKTOTAL", "TOTALTRACKS":
+        tag.TrackTotal = 0
+    case "DISC", "DISCNUMBER":
+        tag.Disc = 0
+    case "DISCTOTAL", "TOTALDISCS":
+        tag.DiscTotal = 0
+    case "YEAR", "DATE":
+        tag.Date = Date{}
+    case "ORIGINALDATE", "ORIGINALYEAR":
+        tag.OriginalDate = Date{}
+    case "COMMENT", "COMMENTS", "COMM":
+        tag.Comment = ""
+        tag.Comments = nil
+    case "GENRE":
+        tag.Genre = ""
+    case "COMPOSER":
+        tag.Composer = ""
+    case "PERFORMER", "TMCL":
+        tag.Performer = ""
+    case "BPM":
+        tag.BPM = 0
+    case "ISRC":
+        tag.ISRC = ""
+    case "LABEL":
+        tag.Label = ""
+    case "COMPILATION":
+        tag.Compilation = false
+    case "LYRICS":
+        tag.Lyrics = ""
+        tag.SyncedLyrics = nil
+    case "UNSYNCEDLYRICS", "USLT":
+        tag.Lyrics = ""
+    case "SYNCEDLYRICS", "SYLT":
+        tag.SyncedLyrics = nil
+    case "CHAPTERS", "CHAP", "CTOC":
+        tag.Chapters = nil
+    case "CUESHEET":
+        // empty sheet keeps the existing one, so removal is marked by the custom field as well
+        tag.CueSheet = CueSheet{}
+        tag.SetCustom(name, "")
+    case "COVER", "COVERS":
+        tag.Covers = nil
+    default:
+        tag.SetCustom(name, "")
+    }
 }
 
 func (tag Tag) Size() int {
     size := len(tag.Title) +
             len(tag.Artist) +
+            len(tag.AlbumArtist) +
             len(tag.Album) +
             len(tag.Comment) +
             len(tag.Genre) +
-            tag.Cover.Size()
-    if tag.Track != 0 {
-        size += int(math.Log10(float64(tag.Track)))
+            len(tag.Composer) +
+            len(tag.Performer) +
+            len(tag.ISRC) +
+            len(tag.Label) +
+            len(tag.Date.String()) +
+            len(tag.OriginalDate.String()) +
+            len(tag.Lyrics)
+    for _, line := range tag.SyncedLyrics {
+        // timestamp and line break
+        size += len(line.Text) + 12
+    }
+    for _, chapter := range tag.Chapters {
+        // timestamps and field names or frame headers
+        size += len(chapter.Title) + 64
+    }
+    size += len(tag.CueSheet.Catalog)
+    for _, track := range tag.CueSheet.Tracks {
+        // field names and index points
+        size += len(track.Title) + len(track.Performer) + len(track.ISRC) + 64 + 12 * len(track.Indexes)
+    }
+    for _, comment := range tag.Comments {
+        // language and frame header or field name
+        size += len(comment.Description) + len(comment.Text) + 16
     }
-    if tag.Year != 0 {
-        size += int(math.Log10(float64(tag.Year)))
+    for _, cover := range tag.Covers {
+        size += cover.Size()
+    }
+    for _, number := range []int{tag.Track, tag.TrackTotal, tag.Disc, tag.DiscTotal, tag.BPM} {
+        if number > 0 {
+            size += len(strconv.Itoa(number))
+        }
+    }
+    if tag.Compilation {
+        size++
+    }
+    for key, value := range tag.Custom {
+        size += len(key) + len(value)
     }
     return size
 }
@@ -47,11 +330,26 @@ func (tag Tag) Size() int {
 func (tag Tag) Empty() bool {
     return len(tag.Title) == 0 &&
            len(tag.Artist) == 0 &&
+           len(tag.AlbumArtist) == 0 &&
            len(tag.Album) == 0 &&
-           tag.Track == 0 && tag.Year == 0 &&
+           tag.Track == 0 && tag.TrackTotal == 0 &&
+           tag.Disc == 0 && tag.DiscTotal == 0 &&
+           tag.Date.Empty() && tag.OriginalDate.Empty() &&
            len(tag.Comment) == 0 &&
+           len(tag.Comments) == 0 &&
            len(tag.Genre) == 0 &&
-           tag.Cover.Empty()
+           len(tag.Composer) == 0 &&
+           len(tag.Performer) == 0 &&
+           tag.BPM == 0 &&
+           len(tag.ISRC) == 0 &&
+           len(tag.Label) == 0 &&
+           !tag.Compilation &&
+           len(tag.Lyrics) == 0 &&
+           len(tag.SyncedLyrics) == 0 &&
+           len(tag.Chapters) == 0 &&
+           tag.CueSheet.Empty() &&
+           len(tag.Custom) == 0 &&
+           len(tag.Covers) == 0
 }
 
 func (tag *Tag) MergeWith(src Tag) {
@@ -61,26 +359,106 @@ func (tag *Tag) MergeWith(src Tag) {
     if len(tag.Artist) == 0 {
         tag.Artist = src.Artist
     }
+    if len(tag.AlbumArtist) == 0 {
+        tag.AlbumArtist = src.AlbumArtist
+    }
     if len(tag.Album) == 0 {
         tag.Album = src.Album
     }
     if tag.Track == 0 {
         tag.Track = src.Track
     }
-    if tag.Year == 0 {
-        tag.Year = src.Year
+    if tag.TrackTotal == 0 {
+        tag.TrackTotal = src.TrackTotal
+    }
+    if tag.Disc == 0 {
+        tag.Disc = src.Disc
+    }
+    if tag.DiscTotal == 0 {
+        tag.DiscTotal = src.DiscTotal
+    }
+    if tag.Date.Empty() {
+        tag.Date = src.Date
+    }
+    if tag.OriginalDate.Empty() {
+        tag.OriginalDate = src.OriginalDate
     }
     if len(tag.Comment) == 0 {
         tag.Comment = src.Comment
+        tag.commentFromDescription = src.commentFromDescription
+    }
+    // comments missing in the tag are taken from source
+    for _, comment := range src.Comments {
+        found := false
+        for _, existing := range tag.Comments {
+            found = found || existing.sameAs(comment)
+        }
+        if !found {
+            tag.Comments = append(tag.Comments, comment)
+        }
     }
     if len(tag.Genre) == 0 {
         tag.Genre = src.Genre
     }
-    if tag.Cover.Empty() {
-        tag.Cover = src.Cover
+    if len(tag.Composer) == 0 {
+        tag.Composer = src.Composer
+    }
+    if len(tag.Performer) == 0 {
+        tag.Performer = src.Performer
+    }
+    if tag.BPM == 0 {
+        tag.BPM = src.BPM
+    }
+    if len(tag.ISRC) == 0 {
+        tag.ISRC = src.ISRC
+    }
+    if len(tag.Label) == 0 {
+        tag.Label = src.Label
+    }
+    if !tag.Compilation {
+        tag.Compilation = src.Compilation
+    }
+    if len(tag.Lyrics) == 0 {
+        tag.Lyrics = src.Lyrics
+    }
+    if len(tag.SyncedLyrics) == 0 {
+        tag.SyncedLyrics = src.SyncedLyrics
+    }
+    if len(tag.Chapters) == 0 {
+        tag.Chapters = src.Chapters
+    }
+    if tag.CueSheet.Empty() {
+        tag.CueSheet = src.CueSheet
+    }
+    // pictures of types missing in the tag are taken from source
+    for _, cover := range src.Covers {
+        found := false
+        for _, existing := range tag.Covers {
+            found = found || existing.TypeCode() == cover.TypeCode()
+        }
+        if !found {
+            tag.Covers = append(tag.Covers, cover)
+        }
+    }
+    for key, value := range src.Custom {
+        if !tag.hasCustom(key) {
+            tag.SetCustom(key, value)
+        }
     }
 }
 
+// Comment is a comment with content description, Language is ISO-639-2 code used by ID3v2 comments
+type Comment struct {
+    Language string
+    Description string
+    Text string
+}
+
+// sameAs checks if comments have the same description and language, case of description is ignored
+func (comment Comment) sameAs(other Comment) bool {
+    return strings.EqualFold(comment.Description, other.Description) && strings.EqualFold(comment.Language, other.Language)
+}
+
 type Cover struct {
     Mime string
     Type string
@@ -101,3 +479,16 @@ func (cover Cover) Size() int {
 func (cover Cover) Empty() bool {
     return cover.Size() == 0
 }
+
+// TypeCode returns ID3v2/FLAC picture type of the cover, pictures without type are front covers
+func (cover Cover) TypeCode() byte {
+    if len(cover.Type) == 0 {
+        return frontCoverType
+    }
+    for code, name := range imageType {
+        if strings.EqualFold(name, cover.Type) {
+            return code
+        }
+    }
+    return 0
+}
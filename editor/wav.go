@@ -0,0 +1,185 @@
+package editor
+
+import (
+    "errors"
+    "io"
+    "strings"
+)
+
+const (
+    wavFormMagic string = "RIFF"
+    wavFormType string = "WAVE"
+    wavInfoListType string = "INFO"
+)
+
+type WavTagEditor struct {
+    id3 Mp3TagEditor
+}
+
+func (editor *WavTagEditor) ReadTag(path string) (Tag, error) {
+    file, size, err := openFile(path)
+    if err != nil {
+        return Tag{}, err
+    }
+    defer file.Close()
+
+    chunks, err := editor.splitFile(file, size)
+    if err != nil {
+        return Tag{}, err
+    }
+
+    var tag, infoTag Tag
+    for _, chunk := range chunks {
+        switch {
+        case editor.isID3Chunk(chunk):
+            if tag, err = editor.id3.parseID3v2Tags(chunk.payload()); err != nil {
+                return Tag{}, err
+            }
+        case editor.isInfoChunk(chunk):
+            infoTag = editor.parseInfoChunk(chunk.payload()[4:])
+        }
+    }
+
+    tag.MergeWith(infoTag)
+    return tag, nil
+}
+
+func (editor *WavTagEditor) WriteTag(src, dst string, tag Tag) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    chunks, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    var existingInfoData []byte = nil
+    var existingFrames23 []id3v2Frame = nil
+    var existingFrames24 []id3v2Frame = nil
+    newChunks := newFileBuilder(file)
+
+    for _, chunk := range chunks {
+        switch {
+        case editor.isID3Chunk(chunk):
+            if existingFrames23, existingFrames24, _, err = editor.id3.readID3v2Tags(chunk.payload()); err != nil {
+                return err
+            }
+        case editor.isInfoChunk(chunk):
+            existingInfoData = chunk.payload()[4:]
+        default:
+            appendRiffChunk(newChunks, chunk, false)
+        }
+    }
+
+    if infoData := editor.makeNewInfoData(tag, existingInfoData); len(infoData) > 0 {
+        newChunks.appendData(makeRiffChunk("LIST", append([]byte(wavInfoListType), infoData ...), false))
+    }
+    // ID3 tag without frames is not written
+    if id3Data := editor.id3.makeNewID3v2TagData(existingFrames23, existingFrames24, tag, 0); len(id3Data) > id3v2HeaderSize {
+        newChunks.appendData(makeRiffChunk("id3 ", id3Data, false))
+    }
+
+    return saveRiffForm(file, size, dst, wavFormMagic, wavFormType, newChunks, false)
+}
+
+// RemoveTag removes ID3 and INFO list chunks
+func (editor *WavTagEditor) RemoveTag(src, dst string) error {
+    file, size, err := openFile(src)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    chunks, err := editor.splitFile(file, size)
+    if err != nil {
+        return err
+    }
+
+    newChunks := newFileBuilder(file)
+    for _, chunk := range chunks {
+        if !editor.isID3Chunk(chunk) && !editor.isInfoChunk(chunk) {
+            appendRiffChunk(newChunks, chunk, false)
+        }
+    }
+
+    return saveRiffForm(file, size, dst, wavFormMagic, wavFormType, newChunks, false)
+}
+
+// splitFile reads chunks of the file, only LIST and ID3 chunks payloads are loaded
+func (editor *WavTagEditor) splitFile(file io.ReaderAt, size int64) ([]riffChunk, error) {
+    header, err := readAt(file, 0, riffFormHeaderSize)
+    if err != nil || string(header[0:4]) != wavFormMagic || string(header[8:12]) != wavFormType {
+        return nil, errors.New("file is not a WAVE file")
+    }
+    return readRiffFileChunks(file, size, false, func(id string) bool {
+        return id == "LIST" || id == "id3 " || id == "ID3 "
+    })
+}
+
+func (editor *WavTagEditor) isID3Chunk(chunk riffChunk) bool {
+    return chunk.id == "id3 " || chunk.id == "ID3 "
+}
+
+func (editor *WavTagEditor) isInfoChunk(chunk riffChunk) bool {
+    return chunk.id == "LIST" && len(chunk.payload()) >= 4 && string(chunk.payload()[0:4]) == wavInfoListType
+}
+
+func (editor *WavTagEditor) parseInfoChunk(data []byte) Tag {
+    var tag Tag
+    for _, chunk := range readRiffChunks(data, false) {
+        value := strings.Trim(string(chunk.payload()), " \x00")
+        switch chunk.id {
+        case "INAM":
+            tag.Title = value
+        case "IART":
+            tag.Artist = value
+        case "IPRD":
+            tag.Album = value
+        case "ICMT":
+            tag.Comment = value
+        case "IGNR":
+            tag.Genre = value
+        case "ITRK", "IPRT":
+            tag.Track, tag.TrackTotal = parseNumberPair(value)
+        case "ICRD":
+            tag.Date = ParseDate(value)
+        }
+    }
+    return tag
+}
+
+func (editor *WavTagEditor) makeNewInfoData(tag Tag, existingInfoData []byte) []byte {
+    result := make([]byte, 0, tag.Size() + len(existingInfoData) + 128)
+
+    addText := func(id, value string) {
+        if len(value) != 0 {
+            result = append(result, makeRiffChunk(id, append([]byte(value), 0), false) ...)
+        }
+    }
+
+    addText("INAM", tag.Title)
+    addText("IART", tag.Artist)
+    addText("IPRD", tag.Album)
+    if tag.Track != 0 {
+        addText("ITRK", formatNumberPair(tag.Track, tag.TrackTotal))
+    }
+    if !tag.Date.Empty() {
+        addText("ICRD", tag.Date.String())
+    }
+    addText("ICMT", tag.Comment)
+    addText("IGNR", tag.Genre)
+
+    for _, chunk := range readRiffChunks(existingInfoData, false) {
+        switch chunk.id {
+        case "INAM", "IART", "IPRD", "ITRK", "IPRT", "ICRD", "ICMT", "IGNR":
+            break
+        default:
+            result = append(result, makeRiffChunk(chunk.id, chunk.payload(), false) ...)
+        }
+    }
+
+    return result
+}
@@ -0,0 +1,69 @@
+package editor
+
+import (
+    "bytes"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+)
+
+// testTrailer follows RIFF form of test file, it looks like a chunk, but is not a part of the form
+var testTrailer = []byte("LIST\x08\x00\x00\x00INFOxxxx")
+
+// makeTestWav makes WAVE form of fmt and data chunks followed by trailing data
+func makeTestWav() []byte {
+    chunks := append(makeRiffChunk("fmt ", make([]byte, 16), false), makeRiffChunk("data", testAudio, false) ...)
+    return append(append(makeRiffFormHeader(wavFormMagic, wavFormType, len(chunks), false), chunks ...), testTrailer ...)
+}
+
+func TestWavTag(t *testing.T) {
+    tests := []struct {
+        name string
+        tag Tag
+        id3Chunk bool
+    }{
+        {"empty tag", Tag{}, false},
+        {"track total", Tag{Title: "Title", Track: 3, TrackTotal: 12}, true},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "test.wav")
+            if err := ioutil.WriteFile(path, makeTestWav(), 0644); err != nil {
+                t.Fatal(err)
+            }
+            editor := NewEditor(Wav)
+            writeTestTag(t, editor, path, test.tag)
+
+            tag, err := editor.ReadTag(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tag.String() != test.tag.String() {
+                t.Errorf("wrong tag:\n%v", tag)
+            }
+
+            data, err := ioutil.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.HasSuffix(data, testTrailer) {
+                t.Error("data after RIFF form is lost")
+            }
+            if id3Chunk := bytes.Contains(data, []byte("id3 ")); id3Chunk != test.id3Chunk {
+                t.Errorf("ID3 chunk is written: %v, expected: %v", id3Chunk, test.id3Chunk)
+            }
+        })
+    }
+}
+
+func TestReadRiffFileChunks(t *testing.T) {
+    data := makeTestWav()
+    chunks, err := readRiffFileChunks(bytes.NewReader(data), int64(len(data)), false, func(string) bool { return true })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(chunks) != 2 || chunks[0].id != "fmt " || chunks[1].id != "data" || !bytes.Equal(chunks[1].payload(), testAudio) {
+        t.Errorf("wrong chunks %v", chunks)
+    }
+}
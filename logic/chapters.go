@@ -0,0 +1,57 @@
+package logic
+
+import (
+    "github.com/mzinin/tagger/editor"
+    "github.com/mzinin/tagger/utils"
+
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+// NewChaptersImporter makes tagger setting chapters from '.chapters.txt' listings next to source files,
+// chapters are stored in ID3v2 tags and Vorbis comments, M4A files are left without them
+func NewChaptersImporter(source, dest string, backup bool, backupDir string, options editor.Options) (*Tagger, error) {
+    tagger, err := NewTagger(source, dest, "ALL", false, backup, backupDir, options)
+    if err != nil {
+        return nil, err
+    }
+    tagger.command = ImportChapters
+    return tagger, nil
+}
+
+func (tagger *Tagger) importChapters(tagEditor editor.Editor, src, dst string) error {
+    data, err := ioutil.ReadFile(sidecarPath(src, ".chapters.txt"))
+    if os.IsNotExist(err) {
+        utils.Log(utils.INFO, "No chapters found for file '%v'", src)
+        return nil
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read chapters for file '%v': %v", src, err)
+        return err
+    }
+
+    chapters := editor.ParseChapters(strings.TrimPrefix(string(data), "\xEF\xBB\xBF"))
+    if len(chapters) == 0 {
+        utils.Log(utils.WARNING, "No chapters parsed for file '%v'", src)
+        return nil
+    }
+    tagger.counter.addFiltered()
+
+    tag, err := tagEditor.ReadTag(src)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read tags from file '%v': %v", src, err)
+        return err
+    }
+    tag.Chapters = chapters
+
+    if err = tagger.saveTag(tagEditor, src, dst, tag); err != nil {
+        return err
+    }
+
+    tagger.counter.addSuccess(true)
+    utils.Log(utils.INFO, "%v chapters successfully imported into file '%v'", len(chapters), dst)
+    return nil
+}
@@ -0,0 +1,65 @@
+package logic
+
+import (
+    "github.com/mzinin/tagger/editor"
+    "github.com/mzinin/tagger/utils"
+
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+// NewCueImporter makes tagger embedding '.cue' sheets next to source FLAC files into them,
+// disc title, performer, date and genre of the sheet fill empty fields of the tag
+func NewCueImporter(source, dest string, backup bool, backupDir string, options editor.Options) (*Tagger, error) {
+    tagger, err := NewTagger(source, dest, "ALL", false, backup, backupDir, options)
+    if err != nil {
+        return nil, err
+    }
+    tagger.command = ImportCue
+    return tagger, nil
+}
+
+func (tagger *Tagger) importCue(tagEditor editor.Editor, src, dst string) error {
+    data, err := ioutil.ReadFile(sidecarPath(src, ".cue"))
+    if os.IsNotExist(err) {
+        utils.Log(utils.INFO, "No cue sheet found for file '%v'", src)
+        return nil
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read cue sheet for file '%v': %v", src, err)
+        return err
+    }
+
+    // track times are stored in FLAC cue sheet block only
+    if _, ok := tagEditor.(*editor.FlacTagEditor); !ok {
+        utils.Log(utils.WARNING, "Cue sheet cannot be embedded into file '%v', only FLAC files are supported", src)
+        return nil
+    }
+    tagger.counter.addFiltered()
+
+    cueTag, err := editor.ParseCue(strings.TrimPrefix(string(data), "\xEF\xBB\xBF"))
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to parse cue sheet for file '%v': %v", src, err)
+        return err
+    }
+
+    tag, err := tagEditor.ReadTag(src)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read tags from file '%v': %v", src, err)
+        return err
+    }
+    tag.CueSheet = cueTag.CueSheet
+    tag.MergeWith(cueTag)
+
+    if err = tagger.saveTag(tagEditor, src, dst, tag); err != nil {
+        return err
+    }
+
+    tagger.counter.addSuccess(true)
+    utils.Log(utils.INFO, "Cue sheet with %v tracks successfully imported into file '%v'", len(tag.CueSheet.Tracks), dst)
+    return nil
+}
@@ -0,0 +1,102 @@
+package logic
+
+import (
+    "github.com/mzinin/tagger/editor"
+    "github.com/mzinin/tagger/utils"
+
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+// NewLyricsImporter makes tagger setting lyrics from '.lrc' files next to source files,
+// LRC files without timestamps are imported as unsynchronised lyrics
+func NewLyricsImporter(source, dest string, backup bool, backupDir string, options editor.Options) (*Tagger, error) {
+    tagger, err := NewTagger(source, dest, "ALL", false, backup, backupDir, options)
+    if err != nil {
+        return nil, err
+    }
+    tagger.command = ImportLyrics
+    return tagger, nil
+}
+
+// NewLyricsExporter makes tagger saving lyrics of files to '.lrc' files in destination, next to source files by default
+func NewLyricsExporter(source, dest string, options editor.Options) (*Tagger, error) {
+    tagger, err := NewTagger(source, dest, "ALL", false, false, "", options)
+    if err != nil {
+        return nil, err
+    }
+    tagger.command = ExportLyrics
+    return tagger, nil
+}
+
+func (tagger *Tagger) importLyrics(tagEditor editor.Editor, src, dst string) error {
+    data, err := ioutil.ReadFile(sidecarPath(src, ".lrc"))
+    if os.IsNotExist(err) {
+        utils.Log(utils.INFO, "No lyrics found for file '%v'", src)
+        return nil
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read lyrics for file '%v': %v", src, err)
+        return err
+    }
+    tagger.counter.addFiltered()
+
+    tag, err := tagEditor.ReadTag(src)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read tags from file '%v': %v", src, err)
+        return err
+    }
+
+    text := strings.TrimPrefix(string(data), "\xEF\xBB\xBF")
+    if lines := editor.ParseLrc(text); len(lines) != 0 {
+        tag.SyncedLyrics = lines
+    } else {
+        tag.Lyrics = strings.TrimSpace(strings.Replace(text, "\r\n", "\n", -1))
+    }
+
+    if err = tagger.saveTag(tagEditor, src, dst, tag); err != nil {
+        return err
+    }
+
+    tagger.counter.addSuccess(len(tag.SyncedLyrics) != 0)
+    utils.Log(utils.INFO, "Lyrics successfully imported into file '%v'", dst)
+    return nil
+}
+
+func (tagger *Tagger) exportLyrics(tagEditor editor.Editor, src, dst string) error {
+    tag, err := tagEditor.ReadTag(src)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to read tags from file '%v': %v", src, err)
+        return err
+    }
+
+    // synchronised lyrics are preferred
+    text := editor.FormatLrc(tag.SyncedLyrics)
+    if len(text) == 0 && len(tag.Lyrics) != 0 {
+        text = tag.Lyrics + "\n"
+    }
+    if len(text) == 0 {
+        utils.Log(utils.INFO, "No lyrics in file '%v'", src)
+        return nil
+    }
+    tagger.counter.addFiltered()
+
+    path := sidecarPath(dst, ".lrc")
+    err = tagger.preparePath(path)
+    if err == nil {
+        err = ioutil.WriteFile(path, []byte(text), 0666)
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to save lyrics to file '%v': %v", path, err)
+        return err
+    }
+
+    tagger.counter.addSuccess(len(tag.SyncedLyrics) != 0)
+    utils.Log(utils.INFO, "Lyrics of file '%v' successfully exported to '%v'", src, path)
+    return nil
+}
@@ -25,6 +25,18 @@ const (
     NoCover  = 1 << iota
 )
 
+// Command is what tagger does with every file
+type Command int
+
+const (
+    Recognize Command = iota
+    Strip
+    ImportLyrics
+    ExportLyrics
+    ImportChapters
+    ImportCue
+)
+
 const (
     numberOfThreads int = 8
 )
@@ -33,18 +45,30 @@ type Tagger struct {
     source string
     sourceInfo os.FileInfo
     destination string
+    backup bool
+    backupDir string
+    command Command
+    stripCovers bool
+    stripFields []string
     filter FilterType
     useExistingTag bool
+    editorOptions editor.Options
     counter *Counter
     stop atomic.Value
 }
 
-func NewTagger(source, dest, filter string, useTag bool) (*Tagger, error) {
+// NewTagger makes tagger, if backup is set original files are kept with '.bak' extension
+// next to them or in backupDir tree if it is not empty
+func NewTagger(source, dest, filter string, useTag, backup bool, backupDir string, options editor.Options) (*Tagger, error) {
     tagger := &Tagger{}
     if err := tagger.init(source, dest, filter); err != nil {
         return nil, err
     }
+    if err := tagger.initBackup(backup, backupDir); err != nil {
+        return nil, err
+    }
     tagger.useExistingTag = useTag
+    tagger.editorOptions = options
     return tagger, nil
 }
 
@@ -99,16 +123,19 @@ func (tagger *Tagger) init(source, dest, filter string) error {
 
         destinationInfo, err := os.Stat(tagger.destination)
         if err != nil {
-            // if input is file consider destination as path to non-existent file
-            if !tagger.sourceInfo.IsDir() && !isSupportedFile(tagger.destination) {
-                utils.Log(utils.ERROR, "Output file '%v' is unsupported", tagger.destination)
-                return fmt.Errorf("Output file '%v' is unsupported", tagger.destination)
-            }
-            // if input is directory consider destination as non-existent directory and try to create it
-            err = os.MkdirAll(tagger.destination, 0666)
-            if err != nil {
-                utils.Log(utils.ERROR, "Failed to create directory '%v': %v", tagger.destination, err)
-                return err
+            // if input is file consider destination as path to non-existent file, it may have no extension
+            if !tagger.sourceInfo.IsDir() {
+                if len(filepath.Ext(tagger.destination)) != 0 && !isSupportedFile(tagger.destination) {
+                    utils.Log(utils.ERROR, "Output file '%v' is unsupported", tagger.destination)
+                    return fmt.Errorf("Output file '%v' is unsupported", tagger.destination)
+                }
+            } else {
+                // if input is directory consider destination as non-existent directory and try to create it
+                err = os.MkdirAll(tagger.destination, 0666)
+                if err != nil {
+                    utils.Log(utils.ERROR, "Failed to create directory '%v': %v", tagger.destination, err)
+                    return err
+                }
             }
         } else {
             if tagger.sourceInfo.IsDir() && !destinationInfo.IsDir() {
@@ -132,6 +159,38 @@ func (tagger *Tagger) init(source, dest, filter string) error {
     return nil
 }
 
+// NewStripper makes tagger removing tags instead of recognizing them: all tags if covers is false
+// and fields is empty, otherwise only covers and the named fields, fields kept in APEv2 and ID3v1 tags
+// would be read back unless editor.UpdateExistingTag or editor.UpdateTag policy is given for these tags
+func NewStripper(source, dest string, covers bool, fields []string, backup bool, backupDir string, options editor.Options) (*Tagger, error) {
+    tagger, err := NewTagger(source, dest, "ALL", false, backup, backupDir, options)
+    if err != nil {
+        return nil, err
+    }
+    tagger.command = Strip
+    tagger.stripCovers = covers
+    tagger.stripFields = fields
+    return tagger, nil
+}
+
+func (tagger *Tagger) initBackup(backup bool, backupDir string) error {
+    tagger.backup = backup || len(backupDir) != 0
+    if len(backupDir) == 0 {
+        return nil
+    }
+
+    var err error
+    tagger.backupDir, err = filepath.Abs(backupDir)
+    if err != nil {
+        utils.Log(utils.ERROR, "Failed to make backup path '%v' absolute: %v", backupDir, err)
+        return err
+    }
+    if strings.HasPrefix(tagger.backupDir + string(filepath.Separator), tagger.destination + string(filepath.Separator)) {
+        return fmt.Errorf("Backup directory '%v' is inside destination '%v'", tagger.backupDir, tagger.destination)
+    }
+    return nil
+}
+
 func (tagger *Tagger) trapSignal() {
     tagger.stop.Store(false)
 
@@ -148,7 +207,25 @@ func (tagger *Tagger) trapSignal() {
 func (tagger *Tagger) processFile(src, dst string) error {
     utils.Log(utils.INFO, "Start processing file '%v'", src)
 
-    tagEditor := makeEditor(src)
+    tagEditor, err := makeEditor(src, tagger.editorOptions)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to detect format of file '%v': %v", src, err)
+        return err
+    }
+    switch tagger.command {
+    case Strip:
+        return tagger.stripFile(tagEditor, src, dst)
+    case ImportLyrics:
+        return tagger.importLyrics(tagEditor, src, dst)
+    case ExportLyrics:
+        return tagger.exportLyrics(tagEditor, src, dst)
+    case ImportChapters:
+        return tagger.importChapters(tagEditor, src, dst)
+    case ImportCue:
+        return tagger.importCue(tagEditor, src, dst)
+    }
+
     tag, err := tagEditor.ReadTag(src)
     if err != nil {
         tagger.counter.addFail()
@@ -186,7 +263,7 @@ func (tagger *Tagger) processFile(src, dst string) error {
     }
 
     // if we need only cover and there is no cover, return here
-    if tagger.filter == NoCover && newTag.Cover.Empty() {
+    if tagger.filter == NoCover && newTag.Cover().Empty() {
         tagger.counter.addFail()
         utils.Log(utils.WARNING, "Cover for file '%v' is not found", src)
         return nil
@@ -194,7 +271,7 @@ func (tagger *Tagger) processFile(src, dst string) error {
 
     // if we need only cover and already has smth else, take only cover
     if tagger.filter == NoCover && !tag.Empty() {
-        tag.Cover = newTag.Cover
+        tag.SetCover(newTag.Cover())
         newTag = tag
     } else {
         newTag.MergeWith(tag)
@@ -207,6 +284,13 @@ func (tagger *Tagger) processFile(src, dst string) error {
         return err
     }
 
+    err = tagger.backupFile(dst)
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to backup file '%v': %v", dst, err)
+        return err
+    }
+
     err = tagEditor.WriteTag(src, dst, newTag)
     if err != nil {
         tagger.counter.addFail()
@@ -214,8 +298,66 @@ func (tagger *Tagger) processFile(src, dst string) error {
         return err
     }
 
-    tagger.counter.addSuccess(!newTag.Cover.Empty())
-    utils.Log(utils.INFO, "File '%v' successfully processed, cover found: %v", src, newTag.Cover.Empty())
+    tagger.counter.addSuccess(!newTag.Cover().Empty())
+    utils.Log(utils.INFO, "File '%v' successfully processed, cover found: %v", src, !newTag.Cover().Empty())
+    return nil
+}
+
+func (tagger *Tagger) stripFile(tagEditor editor.Editor, src, dst string) error {
+    tagger.counter.addFiltered()
+
+    err := tagger.preparePath(dst)
+    if err == nil {
+        err = tagger.backupFile(dst)
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to prepare path '%v': %v", dst, err)
+        return err
+    }
+
+    if !tagger.stripCovers && len(tagger.stripFields) == 0 {
+        err = tagEditor.RemoveTag(src, dst)
+    } else {
+        var tag editor.Tag
+        if tag, err = tagEditor.ReadTag(src); err == nil {
+            if tagger.stripCovers {
+                tag.Covers = nil
+            }
+            for _, field := range tagger.stripFields {
+                tag.RemoveField(field)
+            }
+            err = tagEditor.WriteTag(src, dst, tag)
+        }
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to strip tag and save file '%v': %v", dst, err)
+        return err
+    }
+
+    tagger.counter.addSuccess(true)
+    utils.Log(utils.INFO, "File '%v' successfully stripped", src)
+    return nil
+}
+
+// saveTag writes the tag into destination file, the file is backed up before
+func (tagger *Tagger) saveTag(tagEditor editor.Editor, src, dst string, tag editor.Tag) error {
+    err := tagger.preparePath(dst)
+    if err == nil {
+        err = tagger.backupFile(dst)
+    }
+    if err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to prepare path '%v': %v", dst, err)
+        return err
+    }
+
+    if err = tagEditor.WriteTag(src, dst, tag); err != nil {
+        tagger.counter.addFail()
+        utils.Log(utils.ERROR, "Failed to write tag and save file '%v': %v", dst, err)
+        return err
+    }
     return nil
 }
 
@@ -235,7 +377,7 @@ func (tagger *Tagger) filterByTag(tag editor.Tag) bool {
     if (tagger.filter & NoAlbum) != 0 && len(tag.Album) == 0 {
         return true
     }
-    if (tagger.filter & NoCover) != 0 && tag.Cover.Empty() {
+    if (tagger.filter & NoCover) != 0 && tag.Cover().Empty() {
         return true
     }
     return false
@@ -245,6 +387,36 @@ func (tagger *Tagger) preparePath(path string) error {
     return os.MkdirAll(filepath.Dir(path), 0666)
 }
 
+// backupFile copies the file before it is overwritten, existing backups are kept
+// as they hold the original contents
+func (tagger *Tagger) backupFile(path string) error {
+    if !tagger.backup {
+        return nil
+    }
+    if _, err := os.Stat(path); os.IsNotExist(err) {
+        return nil
+    }
+
+    backupPath := path + ".bak"
+    if len(tagger.backupDir) != 0 {
+        if tagger.sourceInfo.IsDir() && strings.HasPrefix(path, tagger.destination) {
+            backupPath = filepath.Join(tagger.backupDir, path[len(tagger.destination):])
+        } else {
+            backupPath = filepath.Join(tagger.backupDir, filepath.Base(path))
+        }
+    }
+
+    if _, err := os.Stat(backupPath); err == nil {
+        utils.Log(utils.INFO, "Backup '%v' already exists", backupPath)
+        return nil
+    }
+    if err := tagger.preparePath(backupPath); err != nil {
+        return err
+    }
+    utils.Log(utils.DEBUG, "Backup file '%v' to '%v'", path, backupPath)
+    return copyFile(path, backupPath)
+}
+
 func (tagger *Tagger) processDir(src, dst string) error {
     utils.Log(utils.INFO, "Start processing directory '%v'", src)
 
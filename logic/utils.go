@@ -2,19 +2,54 @@ package logic
 
 import (
     "github.com/mzinin/tagger/editor"
+    "github.com/mzinin/tagger/utils"
 
     "fmt"
+    "io"
+    "io/ioutil"
     "os"
     "path/filepath"
     "strings"
 )
 
+// isSupportedFile checks file extension, files with other extensions are checked by their contents,
+// backups are never processed
 func isSupportedFile(file string) bool {
-    switch filepath.Ext(strings.ToLower(file)) {
-    case ".mp3", ".ogg", ".flac":
+    if _, ok := extensionToType(file); ok {
         return true
     }
-    return false
+    if strings.ToLower(filepath.Ext(file)) == ".bak" {
+        return false
+    }
+    _, err := detectType(file)
+    return err == nil
+}
+
+func extensionToType(file string) (editor.EditorType, bool) {
+    switch filepath.Ext(strings.ToLower(file)) {
+    case ".mp3":
+        return editor.Mp3, true
+    case ".ogg", ".oga", ".opus":
+        return editor.Ogg, true
+    case ".flac":
+        return editor.Flac, true
+    case ".m4a":
+        return editor.M4a, true
+    case ".wav":
+        return editor.Wav, true
+    case ".aif", ".aiff":
+        return editor.Aiff, true
+    }
+    return editor.Mp3, false
+}
+
+func detectType(file string) (editor.EditorType, error) {
+    reader, err := os.Open(file)
+    if err != nil {
+        return editor.Mp3, err
+    }
+    defer reader.Close()
+    return editor.DetectType(reader)
 }
 
 func filterStringToType(filter string) (FilterType, error) {
@@ -35,16 +70,16 @@ func filterStringToType(filter string) (FilterType, error) {
     return All, fmt.Errorf("Unknown filter '%v'", filter)
 }
 
-func makeEditor(file string) editor.Editor {
-    switch filepath.Ext(strings.ToLower(file)) {
-    case ".mp3":
-        return editor.NewEditor(editor.Mp3)
-    case ".ogg":
-        return editor.NewEditor(editor.Ogg)
-    case ".flac":
-        return editor.NewEditor(editor.Flac)
+// makeEditor makes editor by file contents, the extension is used only to warn about mismatch
+func makeEditor(file string, options editor.Options) (editor.Editor, error) {
+    editorType, err := detectType(file)
+    if err != nil {
+        return nil, err
     }
-    return nil
+    if extensionType, ok := extensionToType(file); ok && extensionType != editorType {
+        utils.Log(utils.WARNING, "Extension of file '%v' does not match its format", file)
+    }
+    return editor.NewEditor(editorType, options), nil
 }
 
 func getAllFiles(dir string) []string {
@@ -58,4 +93,48 @@ func getAllFiles(dir string) []string {
 
     filepath.Walk(dir, walkFn);
     return result
-}
\ No newline at end of file
+}
+
+// sidecarPath returns path of the file with the same base name as the audio file and the extension
+func sidecarPath(path, extension string) string {
+    return strings.TrimSuffix(path, filepath.Ext(path)) + extension
+}
+
+// copyFile copies file with its mode and modification time through a temporary file,
+// so dst is either complete or not created
+func copyFile(src, dst string) error {
+    source, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer source.Close()
+
+    info, err := source.Stat()
+    if err != nil {
+        return err
+    }
+
+    temp, err := ioutil.TempFile(filepath.Dir(dst), "." + filepath.Base(dst) + ".")
+    if err != nil {
+        return err
+    }
+    if _, err = io.Copy(temp, source); err == nil {
+        err = temp.Chmod(info.Mode().Perm())
+    }
+    if err == nil {
+        err = temp.Sync()
+    }
+    if closeErr := temp.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Chtimes(temp.Name(), info.ModTime(), info.ModTime())
+    }
+    if err == nil {
+        err = os.Rename(temp.Name(), dst)
+    }
+    if err != nil {
+        os.Remove(temp.Name())
+    }
+    return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+    "github.com/mzinin/tagger/editor"
     "github.com/mzinin/tagger/logic"
     "github.com/mzinin/tagger/utils"
 
@@ -15,18 +16,43 @@ var (
     destination string = ""
     filter string = "ALL"
     useExistingTag bool = true
+    backup bool = false
+    backupDir string = ""
+    command logic.Command = logic.Recognize
+    stripCovers bool = false
+    stripFields []string = nil
+    editorOptions editor.Options = editor.DefaultOptions()
 )
 
 func parseCommandLineArguments() bool {
-    if len(os.Args) < 2 {
+    commands := map[string]logic.Command {
+        "strip": logic.Strip,
+        "import-lyrics": logic.ImportLyrics,
+        "export-lyrics": logic.ExportLyrics,
+        "import-chapters": logic.ImportChapters,
+        "import-cue": logic.ImportCue,
+    }
+    first := 1
+    if len(os.Args) > 1 {
+        if c, ok := commands[os.Args[1]]; ok {
+            command = c
+            first = 2
+        }
+    }
+    if command == logic.Strip {
+        // removed fields must not be read back from existing APEv2 and ID3v1 tags
+        editorOptions.ApePolicy = editor.UpdateExistingTag
+        editorOptions.ID3v1Policy = editor.UpdateExistingTag
+    }
+    if len(os.Args) < first + 1 {
         return false
     }
-    if len(os.Args) == 2 && os.Args[1][0] != '-' {
-        source = os.Args[1]
+    if len(os.Args) == first + 1 && os.Args[first][0] != '-' {
+        source = os.Args[first]
         return true
     }
 
-    i := 1
+    i := first
     for i < len(os.Args) {
         switch os.Args[i] {
         case "-h", "--help":
@@ -43,21 +69,110 @@ func parseCommandLineArguments() bool {
         case "-n", "--no-existing-tag":
             useExistingTag = false
             i += 1
+        case "-b", "--backup":
+            backup = true
+            i += 1
+        case "--backup-dir":
+            backupDir = os.Args[i+1]
+            i += 2
+        case "-c", "--covers":
+            stripCovers = true
+            i += 1
+        case "-r", "--fields":
+            stripFields = append(stripFields, strings.Split(os.Args[i+1], ",") ...)
+            i += 2
+        case "-a", "--ape":
+            policy, err := editor.StringToTagPolicy(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            editorOptions.ApePolicy = policy
+            i += 2
+        case "-1", "--id3v1":
+            policy, err := editor.StringToTagPolicy(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            editorOptions.ID3v1Policy = policy
+            i += 2
+        case "-i", "--id3v2-version":
+            version, err := editor.StringToID3v2Version(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            editorOptions.ID3v2Version = version
+            i += 2
+        case "-p", "--padding":
+            padding, err := editor.StringToPadding(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            editorOptions.Padding = padding
+            i += 2
+        case "--in-place":
+            editorOptions.InPlace = true
+            i += 1
+        case "-e", "--charset":
+            charset, err := editor.StringToCharset(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            editorOptions.Charset = charset
+            i += 2
+        case "-g", "--genres":
+            genres, err := editor.ReadGenreMap(os.Args[i+1])
+            if err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                return false
+            }
+            genres.Strict = editorOptions.Genres.Strict
+            editorOptions.Genres = genres
+            i += 2
+        case "--genre-whitelist":
+            editorOptions.Genres.Strict = true
+            i += 1
         default:
             fmt.Fprintf(os.Stderr, "Unexpected argument '%v'\n", os.Args[i])
             return false
         }
     }
+    if editorOptions.Genres.Strict && editorOptions.Genres.Aliases == nil {
+        fmt.Fprintln(os.Stderr, "Argument '--genre-whitelist' requires '--genres'")
+        return false
+    }
     return true
 }
 
 func printUsage() {
     fmt.Printf("Usage of %v %v:\n", os.Args[0], version)
+    fmt.Printf("\t%v [strip | import-lyrics | export-lyrics | import-chapters | import-cue] [options]\n", os.Args[0])
+    fmt.Println("\tstrip                  Remove tags instead of recognizing compositions, all tags by default.")
+    fmt.Println("\timport-lyrics          Set lyrics from '.lrc' files next to input files.")
+    fmt.Println("\texport-lyrics          Save lyrics to '.lrc' files next to output files.")
+    fmt.Println("\timport-chapters        Set chapters from '.chapters.txt' listings next to input files.")
+    fmt.Println("\timport-cue             Embed '.cue' sheets next to input FLAC files into them.")
     fmt.Println("\t-h, --help             Print this message.")
     fmt.Println("\t-s, --source           Input file or directory.")
     fmt.Println("\t-d, --destination      Output file or directory, same as input by default.")
     fmt.Println("\t-f, --filter           File filter: ALL | NO_TAG | NO_TITLE | NO_TITLE_ARTIST | NO_TITLE_ARTIST_ALBUM | NO_COVER. NO_COVER by default.")
     fmt.Println("\t-n, --no-existing-tag  Do not use existing tags to choose recognized tag. False by default.")
+    fmt.Println("\t-b, --backup           Keep original files with '.bak' extension next to them. False by default.")
+    fmt.Println("\t    --backup-dir       Keep original files in this directory tree instead, implies --backup.")
+    fmt.Println("\t-a, --ape              APEv2 tag policy for MP3 files: KEEP | UPDATE | STRIP. KEEP by default, existing tag is updated with strip.")
+    fmt.Println("\t-1, --id3v1            ID3v1 tag policy for MP3 files: KEEP | UPDATE | STRIP. STRIP by default, existing tag is updated with strip.")
+    fmt.Println("\t-i, --id3v2-version    ID3v2 version to write: 3 | 4. 3 by default.")
+    fmt.Println("\t-p, --padding          Bytes reserved in tags for in-place updates. 1024 by default.")
+    fmt.Println("\t    --in-place         Overwrite only tags if they fit into files, faster, but a crash may corrupt files. False by default.")
+    fmt.Println("\t-e, --charset          Charset of legacy 8-bit ID3 text: AUTO | ISO-8859-1 | ISO-8859-2 | ISO-8859-5 | WINDOWS-1250 | WINDOWS-1251 | WINDOWS-1252 | KOI8-R. ISO-8859-1 by default.")
+    fmt.Println("\t-g, --genres           Genre mapping file, every line is a genre optionally followed by '=' and comma separated aliases.")
+    fmt.Println("\t    --genre-whitelist  Drop genres missing in the genre mapping file, requires --genres.")
+    fmt.Println("\t-c, --covers           Remove only covers and fields given by --fields with strip.")
+    fmt.Println("\t-r, --fields           Comma separated fields to remove with strip, e.g. COMMENT,GENRE,PRIV.")
 }
 
 func main() {
@@ -67,7 +182,22 @@ func main() {
         return
     }
 
-    tagger, err := logic.NewTagger(source, destination, filter, useExistingTag)
+    var tagger *logic.Tagger
+    var err error
+    switch command {
+    case logic.Strip:
+        tagger, err = logic.NewStripper(source, destination, stripCovers, stripFields, backup, backupDir, editorOptions)
+    case logic.ImportLyrics:
+        tagger, err = logic.NewLyricsImporter(source, destination, backup, backupDir, editorOptions)
+    case logic.ExportLyrics:
+        tagger, err = logic.NewLyricsExporter(source, destination, editorOptions)
+    case logic.ImportChapters:
+        tagger, err = logic.NewChaptersImporter(source, destination, backup, backupDir, editorOptions)
+    case logic.ImportCue:
+        tagger, err = logic.NewCueImporter(source, destination, backup, backupDir, editorOptions)
+    default:
+        tagger, err = logic.NewTagger(source, destination, filter, useExistingTag, backup, backupDir, editorOptions)
+    }
     if err != nil {
         fmt.Fprintln(os.Stderr, err)
         return
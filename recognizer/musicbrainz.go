@@ -46,7 +46,7 @@ func askMusicBrainz(fingerPrint string, duration int, existingTag ... editor.Tag
 
     tag, releaseId := parseAcousticIdReply(reply, existingTag ...)
     if len(releaseId) > 0 {
-        tag.Cover = askCoverArtArchive(releaseId)
+        tag.SetCover(askCoverArtArchive(releaseId))
     }
 
     return tag, nil
@@ -121,11 +121,13 @@ func parseAcousticIdReply(reply string, existingTag ... editor.Tag) (editor.Tag,
     release := pickRelease(releases, existingTag ...)
 
     var tag editor.Tag
-    tag.Year = getReleaseDate(release)
+    tag.Date = getReleaseDate(release)
     tag.Artist = getReleaseArtist(release)
     tag.Album = getReleaseAlbum(release)
     tag.Title = getReleaseTitle(release)
     tag.Track = getReleaseTrack(release)
+    tag.TrackTotal = getReleaseTrackTotal(release)
+    tag.Disc, tag.DiscTotal = getReleaseDisc(release)
 
     return tag, release["id"].(string)
 }
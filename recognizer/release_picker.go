@@ -39,7 +39,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
        len(tag.Artist) > 0 && len(tag.Album) > 0 && len(tag.Title) > 0 &&
        artist1 == tag.Artist && album1 == tag.Album && title1 == tag.Title &&
        artist2 == tag.Artist && album2 == tag.Album && title2 == tag.Title {
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT data (and the 2nd one has not)
@@ -65,7 +65,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
         if len(album1) == 0 && len(album2) > 0 {
             return false
         }
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT title and artist (and the 2nd one has not)
@@ -94,7 +94,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
         if len(artist1) == 0 && len(artist2) > 0 || various1 && !various2 {
             return false
         }
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT album and title (and the 2nd one has not)
@@ -113,7 +113,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
     if len(tag.Album) > 0 && len(tag.Artist) > 0 &&
        album1 == tag.Album && artist1 == tag.Artist &&
        album2 == tag.Album && artist2 == tag.Artist {
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT album and artist (and the 2nd one has not)
@@ -137,7 +137,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
         if len(artist1) == 0 && len(artist2) > 0 || various1 && !various2 || len(album1) == 0 && len(album2) > 0 {
             return false
         }
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT title (and the 2nd one has not)
@@ -158,7 +158,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
         if len(title1) == 0 && len(title2) > 0 || len(album1) == 0 && len(album2) > 0 {
             return false
         }
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT artist (and the 2nd one has not)
@@ -179,7 +179,7 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
         if len(artist1) == 0 && len(artist2) > 0 || various1 && !various2 || len(title1) == 0 && len(title2) > 0 {
             return false
         }
-        return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+        return !data1.Empty() && (data2.Empty() || data1.Before(data2))
     }
 
     // if 1st release has RIGHT album (and the 2nd one has not)
@@ -199,28 +199,38 @@ func isMoreSuitableRelease(r1, r2 map[string]interface{}, tag editor.Tag) bool {
     if various1 && !various2 {
         return false
     }
-    return data1 != 0 && data1 < data2 || data2 == 0 && data1 != 0
+    return !data1.Empty() && (data2.Empty() || data1.Before(data2))
 }
 
-func getReleaseDate(release map[string]interface{}) int {
+// getReleaseDate returns release date, month and day are optional in the date object
+func getReleaseDate(release map[string]interface{}) editor.Date {
+    var result editor.Date
     if release["date"] != nil {
         date := release["date"].(map[string]interface{})
-        return int(date["year"].(float64))
+        if year, ok := date["year"].(float64); ok {
+            result.Year = int(year)
+        }
+        if month, ok := date["month"].(float64); ok {
+            result.Month = int(month)
+        }
+        if day, ok := date["day"].(float64); ok {
+            result.Day = int(day)
+        }
     }
-    return 0
+    return result
 }
 
+// getReleaseArtist returns names of all credited artists joined as values of the tag field
 func getReleaseArtist(release map[string]interface{}) string {
+    var names []string
     if release["artists"] != nil {
-        artists := release["artists"].([]interface{})
-        if len(artists) != 0 {
-            artist := artists[0].(map[string]interface{})
-            if artist["name"] != nil {
-                return artist["name"].(string)
+        for _, artist := range release["artists"].([]interface{}) {
+            if name, ok := artist.(map[string]interface{})["name"].(string); ok {
+                names = append(names, name)
             }
         }
     }
-    return ""
+    return editor.JoinValues(names ...)
 }
 
 func getReleaseAlbum(release map[string]interface{}) string {
@@ -275,4 +285,37 @@ func getReleaseTrack(release map[string]interface{}) int {
         }
     }
     return 0
+}
+
+// getReleaseTrackTotal returns number of tracks on the medium
+func getReleaseTrackTotal(release map[string]interface{}) int {
+    if release["mediums"] != nil {
+        mediums := release["mediums"].([]interface{})
+        if len(mediums) != 0 {
+            medium := mediums[0].(map[string]interface{})
+            if count, ok := medium["track_count"].(float64); ok {
+                return int(count)
+            }
+        }
+    }
+    return 0
+}
+
+// getReleaseDisc returns position of the medium and number of mediums, single medium releases have no disc number
+func getReleaseDisc(release map[string]interface{}) (int, int) {
+    total := 0
+    if count, ok := release["medium_count"].(float64); ok {
+        total = int(count)
+    }
+    if total < 2 || release["mediums"] == nil {
+        return 0, 0
+    }
+    mediums := release["mediums"].([]interface{})
+    if len(mediums) != 0 {
+        medium := mediums[0].(map[string]interface{})
+        if position, ok := medium["position"].(float64); ok {
+            return int(position), total
+        }
+    }
+    return 0, 0
 }
\ No newline at end of file
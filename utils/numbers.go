@@ -5,6 +5,11 @@ func ReadInt32Be(data []byte) int {
     return ((int(data[0]) * 0x100 + int(data[1])) * 0x100 + int(data[2])) * 0x100 + int(data[3])
 }
 
+// ReadSyncInt32Be reads synchsafe integer (7 bits per byte) used by ID3v2
+func ReadSyncInt32Be(data []byte) int {
+    return ((int(data[0]) * 0x80 + int(data[1])) * 0x80 + int(data[2])) * 0x80 + int(data[3])
+}
+
 func ReadInt32Le(data []byte) int {
     return ((int(data[3]) * 0x100 + int(data[2])) * 0x100 + int(data[1])) * 0x100 + int(data[0])
 }
@@ -62,3 +67,37 @@ func WriteInt24Be(size int, dst []byte) {
         size = size / 0x100
     }
 }
+
+func ReadInt16Be(data []byte) int {
+    return int(data[0]) * 0x100 + int(data[1])
+}
+
+func ReadInt16Le(data []byte) int {
+    return int(data[1]) * 0x100 + int(data[0])
+}
+
+func ReadInt64Le(data []byte) int64 {
+    var result int64 = 0
+    for i := 7; i >= 0; i-- {
+        result = result * 0x100 + int64(data[i])
+    }
+    return result
+}
+
+func ReadInt64Be(data []byte) int64 {
+    var result int64 = 0
+    for i := 0; i < 8; i++ {
+        result = result * 0x100 + int64(data[i])
+    }
+    return result
+}
+
+func WriteInt64Be(size int64, dst []byte) {
+    if len(dst) < 8 {
+        return
+    }
+    for i := 7; i >= 0; i-- {
+        dst[i] = byte(size % 0x100)
+        size = size / 0x100
+    }
+}